@@ -0,0 +1,45 @@
+{{define "title"}}{{.t.account_title}}{{end}}
+<div class="fullPage">
+    <div class="contentWrap">
+        <img src="{{mountpathed "static/logo-neg.png"}}" alt="{{.t.login_logo_alt}}" />
+        <div class="loginForm">
+            <h1>{{.t.account_title}}</h1>
+            {{with .flash_success}}<span>{{.}}</span>{{end}}
+
+            <form action="{{mountpathed "account/name"}}" method="POST">
+                <h2>{{.t.account_name}}</h2>
+                {{with .name_error}}<span>{{.}}</span><br />{{end}}
+                <input class="input" type="text" name="name" value="{{.user.Name}}" /><br />
+                {{with .csrf_token}}<input type="hidden" name="csrf_token" value="{{.}}" />{{end}}
+                <button class="login" type="submit">{{.t.account_save}}</button>
+            </form>
+
+            <form action="{{mountpathed "account/password"}}" method="POST">
+                <h2>{{.t.account_password}}</h2>
+                {{with .password_error}}<span>{{.}}</span><br />{{end}}
+                <input class="input" type="password" name="current_password" placeholder="{{.t.account_current_password}}" /><br />
+                <input class="input" type="password" name="password" placeholder="{{.t.account_new_password}}" /><br />
+                <input class="input" type="password" name="confirm_password" placeholder="{{.t.account_confirm_password}}" /><br />
+                {{with .csrf_token}}<input type="hidden" name="csrf_token" value="{{.}}" />{{end}}
+                <button class="login" type="submit">{{.t.account_save}}</button>
+            </form>
+
+            <h2>{{.t.twofa_title}}</h2>
+            {{if .totp_enabled}}
+                <a href="{{mountpathed "2fa/totp/remove"}}">{{.t.account_totp_remove}}</a>
+                <a href="{{mountpathed "2fa/recovery/regen"}}">{{.t.account_recovery_codes}}</a>
+            {{else}}
+                <a href="{{mountpathed "2fa/totp/setup"}}">{{.t.account_totp_setup}}</a>
+            {{end}}
+
+            <h2>{{.t.account_activity}}</h2>
+            {{range .user.Logins}}
+                <span>{{.Time.Format "2006-01-02 15:04"}} &middot; {{.IP}} &middot; {{.UserAgent}}</span><br />
+            {{else}}
+                <span>{{.t.account_no_activity}}</span>
+            {{end}}
+
+            <a href="{{mountpathed "apps"}}">{{.t.apps_title}}</a>
+        </div>
+    </div>
+</div>
@@ -0,0 +1,28 @@
+{{define "title"}}{{.t.apps_title}}{{end}}
+<div class="fullPage">
+    <div class="contentWrap">
+        <img src="{{mountpathed "static/logo-neg.png"}}" alt="{{.t.login_logo_alt}}" />
+        <div class="loginForm">
+            <h1>{{.t.apps_title}}</h1>
+            {{with .flash_success}}<span>{{.}}</span>{{end}}
+            {{range .sessions}}
+                <form action="{{mountpathed "apps/revoke"}}" method="POST">
+                    <strong>{{.ConsentRequest.Client.DisplayName}}</strong><br />
+                    <span>{{$.t.apps_scopes}}: {{range $i, $s := .GrantScope}}{{if $i}}, {{end}}{{$s}}{{end}}</span><br />
+                    <span>{{$.t.apps_granted}}: {{.HandledAt.Format "2006-01-02"}}</span><br />
+                    {{with $.csrf_token}}<input type="hidden" name="csrf_token" value="{{.}}" />{{end}}
+                    <input type="hidden" name="client_id" value="{{.ConsentRequest.Client.ClientID}}" />
+                    <button class="login" type="submit">{{$.t.apps_revoke}}</button>
+                </form>
+            {{else}}
+                <span>{{.t.apps_none}}</span>
+            {{end}}
+            {{if .sessions}}
+                <form action="{{mountpathed "apps/revoke"}}" method="POST">
+                    {{with .csrf_token}}<input type="hidden" name="csrf_token" value="{{.}}" />{{end}}
+                    <button class="login" type="submit">{{.t.apps_revoke_all}}</button>
+                </form>
+            {{end}}
+        </div>
+    </div>
+</div>
@@ -0,0 +1,10 @@
+{{define "title"}}{{.t.error_title}}{{end}}
+<div class="fullPage">
+    <div class="contentWrap">
+        <img src="{{mountpathed "static/logo-neg.png"}}" alt="{{.t.login_logo_alt}}" />
+        <div class="loginForm">
+            <h1>{{.t.error_heading}}</h1>
+            <p>{{.message}}</p>
+        </div>
+    </div>
+</div>
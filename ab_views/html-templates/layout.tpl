@@ -1,5 +1,5 @@
 <!DOCTYPE html>
-<html>
+<html lang="{{.lang}}">
     <head>
         <title>{{block "title" .}}{{end}}</title>
         <link href="{{mountpathed "/static/main.css"}}" rel="stylesheet">
@@ -1,23 +1,25 @@
+{{define "title"}}{{.t.login_title}}{{end}}
 <div class="fullPage">
     <div class="contentWrap">
-        <img src="{{mountpathed "static/logo-neg.png"}}" alt="Nearby Computing logo" />
+        <img src="{{mountpathed "static/logo-neg.png"}}" alt="{{.t.login_logo_alt}}" />
         <form class="loginForm" action="{{mountpathed "login"}}" method="POST">
+            {{with .client_name}}<span>{{$.t.login_continue_to}} {{.}}</span>{{end}}
             {{with .error}}{{.}}<br />{{end}}
-            <input class="input" type="text" class="form-control" name="email" placeholder="E-mail" value="{{.primaryIDValue}}"><br />
-            <input class="input" type="password" class="form-control" name="password" placeholder="Password"><br />
+            <input class="input" type="text" class="form-control" name="email" placeholder="{{.t.login_email}}" value="{{with .primaryIDValue}}{{.}}{{else}}{{.login_hint}}{{end}}"><br />
+            <input class="input" type="password" class="form-control" name="password" placeholder="{{.t.login_password}}"><br />
             {{with .csrf_token}}<input type="hidden" name="csrf_token" value="{{.}}" />{{end}}
             {{with .challenge}}<input type="hidden" name="challenge" value="{{.}}" />{{end}}
             <div class="loginRow">
                 {{with .modules}}{{with .remember}}
                     <label class="rememberMe">
-                        <input type="checkbox" name="rm" value="true" checked> Remember Me</input>
+                        <input type="checkbox" name="rm" value="true" checked> {{$.t.login_remember_me}}</input>
                     </label>
                 {{end}}{{end -}}
                 {{with .redir}}<input type="hidden" name="redir" value="{{.}}" />{{end}}
-                <button class="login" type="submit">Login</button>
+                <button class="login" type="submit">{{.t.login_submit}}</button>
             </div>
-            {{with .modules}}{{with .recover}}<br /><a href="{{mountpathed "recover"}}">Recover Account</a>{{end}}{{end -}}
-            {{with .modules}}{{with .register}}<br /><a href="{{mountpathed "register"}}">Register Account</a>{{end}}{{end -}}
+            {{with .modules}}{{with .recover}}<br /><a href="{{mountpathed "recover"}}">{{$.t.login_recover}}</a>{{end}}{{end -}}
+            {{with .modules}}{{with .register}}<br /><a href="{{mountpathed "register"}}">{{$.t.login_register}}</a>{{end}}{{end -}}
         </form>
     </div>
 </div>
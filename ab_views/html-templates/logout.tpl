@@ -0,0 +1,18 @@
+{{define "title"}}{{.t.logout_title}}{{end}}
+<div class="fullPage">
+    <div class="contentWrap">
+        <img src="{{mountpathed "static/logo-neg.png"}}" alt="{{.t.login_logo_alt}}" />
+        <form class="loginForm" action="{{mountpathed "logout"}}" method="POST">
+            <span>{{.t.logout_question}}</span>
+            {{with .csrf_token}}<input type="hidden" name="csrf_token" value="{{.}}" />{{end}}
+            <input type="hidden" name="challenge" value="{{.challenge}}" />
+            <label class="rememberMe">
+                <input type="checkbox" name="everywhere" value="true"> {{.t.logout_everywhere}}</input>
+            </label>
+            <div class="loginRow">
+                <button class="login" type="submit" name="confirm" value="false">{{.t.logout_no}}</button>
+                <button class="login" type="submit" name="confirm" value="true">{{.t.logout_yes}}</button>
+            </div>
+        </form>
+    </div>
+</div>
@@ -0,0 +1,17 @@
+{{define "title"}}{{.t.twofa_title}}{{end}}
+{{with .recovery_codes -}}
+    <h1>{{$.t.recovery_regenerated}}</h1>
+    <p>
+        <span>{{$.t.twofa_recovery_codes}}:</span></br>
+        {{range . -}}
+        <span>{{.}}</span><br />
+        {{end -}}
+    </p>
+{{else -}}
+    <span>{{.n_recovery_codes}} {{.t.recovery_remaining}}</span>
+    <form action="{{mountpathed "2fa/recovery/regen"}}" method="POST">
+        {{with .error}}{{.}}<br />{{end}}
+        {{with .csrf_token}}<input type="hidden" name="csrf_token" value="{{.}}" />{{end}}
+        <button type="submit">{{.t.recovery_regenerate}}</button>
+    </form>
+{{end -}}
@@ -0,0 +1,11 @@
+{{define "title"}}{{.t.twofa_title}}{{end}}
+<h1>{{.t.totp_confirm}}</h1>
+<img src="{{mountpathed "2fa/totp/qr"}}" alt="{{.t.totp_qr_alt}}" /><br />
+<span>{{.t.totp_key}}: {{.totpsecret}}</span>
+<form action="{{mountpathed "2fa/totp/confirm"}}" method="POST">
+    {{with .error}}{{.}}<br />{{end}}
+    {{with .errors}}{{range .code}}<span>{{.}}</span><br />{{end}}{{end -}}
+    <input type="text" class="form-control" name="code" placeholder="{{.t.twofa_code}}" autocomplete="off"><br />
+    {{with .csrf_token}}<input type="hidden" name="csrf_token" value="{{.}}" />{{end}}
+    <button type="submit">{{.t.twofa_ok}}</button>
+</form>
@@ -0,0 +1,8 @@
+{{define "title"}}{{.t.twofa_title}}{{end}}
+<h1>{{.t.totp_enabled}}</h1>
+<p>
+    <span>{{.t.twofa_recovery_codes}}:</span></br>
+    {{range .recovery_codes -}}
+    <span>{{.}}</span><br />
+    {{end -}}
+</p>
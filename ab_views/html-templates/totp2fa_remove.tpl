@@ -0,0 +1,10 @@
+{{define "title"}}{{.t.twofa_title}}{{end}}
+<h1>{{.t.totp_remove}}</h1>
+<form action="{{mountpathed "2fa/totp/remove"}}" method="POST">
+    {{with .error}}{{.}}<br />{{end}}
+    {{with .errors}}{{range .code}}<span>{{.}}</span><br />{{end}}{{end -}}
+    <input type="text" class="form-control" name="code" placeholder="{{.t.twofa_code}}" autocomplete="off"><br />
+    <input type="text" class="form-control" name="recovery_code" placeholder="{{.t.twofa_recovery_code}}" autocomplete="off"><br />
+    {{with .csrf_token}}<input type="hidden" name="csrf_token" value="{{.}}" />{{end}}
+    <button type="submit">{{.t.twofa_ok}}</button>
+</form>
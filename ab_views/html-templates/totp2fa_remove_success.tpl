@@ -0,0 +1,2 @@
+{{define "title"}}{{.t.twofa_title}}{{end}}
+<h1>{{.t.totp_removed}}</h1>
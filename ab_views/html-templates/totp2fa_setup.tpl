@@ -0,0 +1,6 @@
+{{define "title"}}{{.t.twofa_title}}{{end}}
+<h1>{{.t.twofa_setup}}</h1>
+<form action="{{mountpathed "2fa/totp/setup"}}" method="POST">
+    <button type="submit">{{.t.twofa_begin_setup}}</button>
+    {{with .csrf_token}}<input type="hidden" name="csrf_token" value="{{.}}" />{{end}}
+</form>
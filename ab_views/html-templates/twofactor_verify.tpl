@@ -0,0 +1,7 @@
+{{define "title"}}{{.t.twofa_title}}{{end}}
+<h1>{{.t.twofa_verify}}</h1>
+<form action="{{.url}}" method="POST">
+    <input type="text" class="form-control" name="code" placeholder="{{.t.login_email}}" disabled="true" autocomplete="off" value="{{.email}}"><br />
+    {{with .csrf_token}}<input type="hidden" name="csrf_token" value="{{.}}" />{{end}}
+    <button type="submit">{{.t.twofa_ok}}</button>
+</form>
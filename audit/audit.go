@@ -0,0 +1,152 @@
+// Package audit keeps an append-only record of authentication events: who
+// logged in, when, from where, for which client and what they consented to.
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/nbycomp/login-consent/logging"
+	"github.com/nbycomp/login-consent/proxy"
+)
+
+// Event types
+const (
+	LoginSucceeded  = "login.succeeded"
+	LoginFailed     = "login.failed"
+	LoginRejected   = "login.rejected"
+	LoginAccepted   = "login.accepted"
+	AccountLocked   = "account.locked"
+	Logout          = "logout"
+	LogoutAccepted  = "logout.accepted"
+	LogoutRejected  = "logout.rejected"
+	ConsentAccepted = "consent.accepted"
+	ConsentRejected = "consent.rejected"
+	ConsentRevoked  = "consent.revoked"
+	TOTPEnabled     = "2fa.totp.enabled"
+	TOTPRemoved     = "2fa.totp.removed"
+	RecoveryCodes   = "2fa.recovery.regenerated"
+	PasswordChanged = "password.changed"
+)
+
+// Event is a single audit record
+type Event struct {
+	Time      time.Time `json:"time"`
+	Type      string    `json:"type"`
+	User      string    `json:"user,omitempty"`
+	Subject   string    `json:"subject,omitempty"`
+	Methods   []string  `json:"methods,omitempty"`
+	ClientID  string    `json:"client_id,omitempty"`
+	Scopes    []string  `json:"scopes,omitempty"`
+	Challenge string    `json:"challenge,omitempty"`
+	Reason    string    `json:"reason,omitempty"`
+	IP        string    `json:"ip,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	RequestID string    `json:"request_id,omitempty"`
+}
+
+// Sink stores audit events
+type Sink interface {
+	Write(Event) error
+	Close() error
+}
+
+type contextKey struct{}
+
+// NewContext returns a context whose events are written to sink
+func NewContext(ctx context.Context, sink Sink) context.Context {
+	return context.WithValue(ctx, contextKey{}, sink)
+}
+
+// FromContext returns the sink on the context. Without one, events are
+// discarded.
+func FromContext(ctx context.Context) Sink {
+	if sink, ok := ctx.Value(contextKey{}).(Sink); ok {
+		return sink
+	}
+
+	return Discard{}
+}
+
+// Record fills in the time and the client details of r and writes the event
+// to the sink of the request. Failures are logged rather than returned, so
+// that auditing never gets in the way of a login.
+func Record(r *http.Request, e Event) {
+	e.Time = time.Now().UTC()
+	e.UserAgent = r.UserAgent()
+	e.RequestID = logging.RequestID(r.Context())
+	e.IP = proxy.ClientIP(r)
+
+	if err := FromContext(r.Context()).Write(e); err != nil {
+		logging.FromContext(r.Context()).Error("failed to write audit event", "type", e.Type, "error", err)
+	}
+}
+
+// Discard drops every event
+type Discard struct{}
+
+// Write does nothing
+func (Discard) Write(Event) error { return nil }
+
+// Close does nothing
+func (Discard) Close() error { return nil }
+
+// WriterSink writes events as JSON lines
+type WriterSink struct {
+	mu  sync.Mutex
+	w   io.Writer
+	enc *json.Encoder
+}
+
+// NewWriterSink writes events to w
+func NewWriterSink(w io.Writer) *WriterSink {
+	return &WriterSink{w: w, enc: json.NewEncoder(w)}
+}
+
+// Write appends the event as a line of JSON
+func (s *WriterSink) Write(e Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.enc.Encode(e); err != nil {
+		return err
+	}
+
+	if f, ok := s.w.(*os.File); ok {
+		return f.Sync()
+	}
+
+	return nil
+}
+
+// Close closes the underlying writer if it can be closed
+func (s *WriterSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if c, ok := s.w.(io.Closer); ok && s.w != os.Stdout && s.w != os.Stderr {
+		return c.Close()
+	}
+
+	return nil
+}
+
+// OpenFile opens filename for appending, creating it if needed. "-" writes
+// to standard output.
+func OpenFile(filename string) (*WriterSink, error) {
+	if filename == "-" {
+		return NewWriterSink(os.Stdout), nil
+	}
+
+	f, err := os.OpenFile(filename, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewWriterSink(f), nil
+}
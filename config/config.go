@@ -0,0 +1,487 @@
+// Package config loads the settings of the service from a file, environment
+// variables and command-line flags.
+//
+// Every setting has a name such as hydra_admin_url, which is the key in the
+// configuration file. The environment variable is the name in upper case,
+// HYDRA_ADMIN_URL, and the flag has dashes instead, -hydra-admin-url. Flags
+// override environment variables, which override the file, which overrides
+// the defaults.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Config holds every setting of the service. Fields tagged `log:"secret"`
+// are redacted when the configuration is logged.
+type Config struct {
+	Port    string `config:"port"`
+	RootURL string `config:"root_url"`
+
+	HydraAdminURL       string `config:"hydra_admin_url"`
+	HydraCAFile         string `config:"hydra_ca_file"`
+	HydraClientCertFile string `config:"hydra_client_cert_file"`
+	HydraClientKeyFile  string `config:"hydra_client_key_file"`
+
+	CookieStoreKey      string `config:"cookie_store_key" log:"secret"`
+	CookieStoreKeyFile  string `config:"cookie_store_key_file"`
+	SessionStoreKey     string `config:"session_store_key" log:"secret"`
+	SessionStoreKeyFile string `config:"session_store_key_file"`
+
+	// SessionStore is where sessions are kept: in the cookie, or on the
+	// server in memory or in the SQL database at SessionStoreDSN
+	SessionStore    string        `config:"session_store"`
+	SessionStoreDSN string        `config:"session_store_dsn" log:"secret"`
+	SessionTTL      time.Duration `config:"session_ttl"`
+
+	TrustedProxies   string `config:"trusted_proxies"`
+	RateLimitIP      string `config:"rate_limit_ip"`
+	RateLimitAccount string `config:"rate_limit_account"`
+
+	// LockAfter failed logins within LockWindow lock an account for
+	// LockDuration
+	LockAfter    int           `config:"lock_after"`
+	LockWindow   time.Duration `config:"lock_window"`
+	LockDuration time.Duration `config:"lock_duration"`
+
+	// FrameAncestors are the origins allowed to frame the login, for an
+	// embedded login. Other pages cannot be framed.
+	FrameAncestors string        `config:"frame_ancestors"`
+	HSTSMaxAge     time.Duration `config:"hsts_max_age"`
+
+	// Production refuses to start with settings that are only fit for
+	// development, such as generated keys
+	Production bool `config:"production"`
+
+	ImportUsers   string `config:"import_users"`
+	LogoutConfirm bool   `config:"logout_confirm"`
+	PairwiseSalt  string `config:"pairwise_salt" log:"secret"`
+
+	LogLevel  string `config:"log_level"`
+	LogFormat string `config:"log_format"`
+	Debug     bool   `config:"debug"`
+	DebugDB   bool   `config:"debug_db"`
+	DebugCTX  bool   `config:"debug_ctx"`
+	AuditLog  string `config:"audit_log"`
+
+	MetricsPort string `config:"metrics_port"`
+
+	TLSCertFile string `config:"tls_cert_file"`
+	TLSKeyFile  string `config:"tls_key_file"`
+
+	ReadHeaderTimeout time.Duration `config:"read_header_timeout"`
+	ReadTimeout       time.Duration `config:"read_timeout"`
+	WriteTimeout      time.Duration `config:"write_timeout"`
+	IdleTimeout       time.Duration `config:"idle_timeout"`
+	ShutdownTimeout   time.Duration `config:"shutdown_timeout"`
+}
+
+// Default returns the configuration used for settings that are not given
+func Default() Config {
+	return Config{
+		Port:              "3000",
+		LogFormat:         "json",
+		MetricsPort:       "9090",
+		SessionStore:      SessionStoreCookie,
+		SessionTTL:        30 * 24 * time.Hour,
+		RateLimitIP:       "20/1m",
+		RateLimitAccount:  "5/1m",
+		LockAfter:         10,
+		LockWindow:        15 * time.Minute,
+		LockDuration:      15 * time.Minute,
+		HSTSMaxAge:        365 * 24 * time.Hour,
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       30 * time.Second,
+		WriteTimeout:      30 * time.Second,
+		IdleTimeout:       120 * time.Second,
+		ShutdownTimeout:   30 * time.Second,
+	}
+}
+
+// The places sessions can be kept in
+const (
+	SessionStoreCookie = "cookie"
+	SessionStoreMemory = "memory"
+	SessionStoreSQL    = "sql"
+)
+
+// fileSetting names the configuration file, given as -config or CONFIG_FILE
+const fileSetting = "config"
+
+// Load reads the configuration file, the environment and the command-line
+// arguments, without the program name, and validates the result.
+func Load(args []string) (Config, error) {
+	cfg := Default()
+
+	flags := map[string]string{}
+	fs := flag.NewFlagSet("login-consent", flag.ContinueOnError)
+	fs.String(fileSetting, "", "a YAML or JSON configuration `file`")
+	for _, f := range fields() {
+		fs.Var(&flagValue{name: f.name, values: flags, isBool: f.kind == reflect.Bool}, f.flagName(), f.usage())
+	}
+	if err := fs.Parse(args); err != nil {
+		return cfg, err
+	}
+
+	filename := fs.Lookup(fileSetting).Value.String()
+	if filename == "" {
+		filename = os.Getenv(strings.ToUpper(fileSetting) + "_FILE")
+	}
+	if filename != "" {
+		values, err := readFile(filename)
+		if err != nil {
+			return cfg, err
+		}
+		if err := cfg.apply(values, "file "+filename); err != nil {
+			return cfg, err
+		}
+	}
+
+	env := map[string]string{}
+	for _, f := range fields() {
+		if v, ok := os.LookupEnv(f.envName()); ok {
+			env[f.name] = v
+		}
+	}
+	if err := cfg.apply(env, "environment"); err != nil {
+		return cfg, err
+	}
+
+	if err := cfg.apply(flags, "flags"); err != nil {
+		return cfg, err
+	}
+
+	cfg.derive()
+
+	return cfg, cfg.Validate()
+}
+
+// derive fills in the settings whose default depends on others
+func (c *Config) derive() {
+	if c.LogLevel == "" {
+		c.LogLevel = "info"
+		if c.Debug || c.DebugDB || c.DebugCTX {
+			c.LogLevel = "debug"
+		}
+	}
+
+	if c.RootURL == "" {
+		scheme := "http"
+		if c.TLSCertFile != "" {
+			scheme = "https"
+		}
+		c.RootURL = scheme + "://localhost:" + c.Port
+	}
+}
+
+// Validate checks every setting, reporting all the problems found at once.
+// The settings parsed by other packages, such as log_level, trusted_proxies,
+// the rate limits and frame_ancestors, are checked by server.Validate.
+func (c Config) Validate() error {
+	var errs []string
+	invalid := func(name, format string, args ...interface{}) {
+		errs = append(errs, name+": "+fmt.Sprintf(format, args...))
+	}
+
+	if c.HydraAdminURL == "" {
+		invalid("hydra_admin_url", "is required, e.g. http://hydra:4445")
+	} else if err := checkURL(c.HydraAdminURL); err != nil {
+		invalid("hydra_admin_url", "%v", err)
+	}
+
+	if err := checkURL(c.RootURL); err != nil {
+		invalid("root_url", "%v", err)
+	}
+
+	if err := checkPort(c.Port); err != nil {
+		invalid("port", "%v", err)
+	}
+	if err := checkPort(c.MetricsPort); err != nil {
+		invalid("metrics_port", "%v", err)
+	} else if c.MetricsPort == c.Port {
+		invalid("metrics_port", "must differ from port %s", c.Port)
+	}
+
+	for _, key := range []struct {
+		name, value, file string
+		load              func() ([]KeyPair, error)
+	}{
+		{"cookie_store_key", c.CookieStoreKey, c.CookieStoreKeyFile, c.CookieKeys},
+		{"session_store_key", c.SessionStoreKey, c.SessionStoreKeyFile, c.SessionKeys},
+	} {
+		if key.value != "" && key.file != "" {
+			invalid(key.name, "must not be given together with %s_file", key.name)
+			continue
+		}
+
+		keys, err := key.load()
+		if err != nil && key.file != "" {
+			invalid(key.name+"_file", "%v", err)
+		} else if err != nil {
+			invalid(key.name, "%v", err)
+		} else if len(keys) == 0 && c.Production {
+			invalid(key.name, "is required in production, or users are logged out on every restart and by every other replica")
+		}
+	}
+
+	switch c.SessionStore {
+	case SessionStoreCookie, SessionStoreMemory:
+	case SessionStoreSQL:
+		if c.SessionStoreDSN == "" {
+			invalid("session_store_dsn", "is required with session_store sql, e.g. postgres://user:password@db/login?sslmode=require")
+		}
+	default:
+		invalid("session_store", "must be cookie, memory or sql, not %q", c.SessionStore)
+	}
+
+	if c.LockAfter < 1 {
+		invalid("lock_after", "must be at least 1")
+	}
+
+	if c.HSTSMaxAge < 0 {
+		invalid("hsts_max_age", "must not be negative")
+	}
+
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		invalid("tls_cert_file", "must be given together with tls_key_file")
+	}
+	if (c.HydraClientCertFile == "") != (c.HydraClientKeyFile == "") {
+		invalid("hydra_client_cert_file", "must be given together with hydra_client_key_file")
+	}
+
+	for _, file := range []struct{ name, value string }{
+		{"import_users", c.ImportUsers},
+		{"tls_cert_file", c.TLSCertFile},
+		{"tls_key_file", c.TLSKeyFile},
+		{"hydra_ca_file", c.HydraCAFile},
+		{"hydra_client_cert_file", c.HydraClientCertFile},
+		{"hydra_client_key_file", c.HydraClientKeyFile},
+	} {
+		if file.value == "" {
+			continue
+		}
+		if _, err := os.Stat(file.value); err != nil {
+			invalid(file.name, "%v", err)
+		}
+	}
+
+	for _, timeout := range []struct {
+		name  string
+		value time.Duration
+	}{
+		{"read_header_timeout", c.ReadHeaderTimeout},
+		{"read_timeout", c.ReadTimeout},
+		{"write_timeout", c.WriteTimeout},
+		{"idle_timeout", c.IdleTimeout},
+		{"shutdown_timeout", c.ShutdownTimeout},
+		{"session_ttl", c.SessionTTL},
+		{"lock_window", c.LockWindow},
+		{"lock_duration", c.LockDuration},
+	} {
+		if timeout.value <= 0 {
+			invalid(timeout.name, "must be positive")
+		}
+	}
+
+	if len(errs) > 0 {
+		return errors.New("invalid configuration:\n  " + strings.Join(errs, "\n  "))
+	}
+
+	return nil
+}
+
+// redacted replaces secrets in Redacted, as the logger does in log lines
+const redacted = "[REDACTED]"
+
+// Redacted returns the settings by name, with the secrets replaced, for
+// logging
+func (c Config) Redacted() map[string]string {
+	out := map[string]string{}
+
+	v := reflect.ValueOf(c)
+	for _, f := range fields() {
+		value := v.FieldByIndex(f.index)
+		if f.secret {
+			if value.IsZero() {
+				out[f.name] = ""
+			} else {
+				out[f.name] = redacted
+			}
+			continue
+		}
+
+		out[f.name] = fmt.Sprint(value.Interface())
+	}
+
+	return out
+}
+
+// apply sets the fields named in values, which came from source
+func (c *Config) apply(values map[string]string, source string) error {
+	v := reflect.ValueOf(c).Elem()
+	for _, f := range fields() {
+		s, ok := values[f.name]
+		if !ok {
+			continue
+		}
+
+		if err := f.set(v.FieldByIndex(f.index), s); err != nil {
+			return fmt.Errorf("invalid configuration: %s from %s: %v", f.name, source, err)
+		}
+	}
+
+	return nil
+}
+
+// readFile reads a flat YAML or JSON object of settings
+func readFile(filename string) (map[string]string, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw map[string]interface{}
+	if err := yaml.Unmarshal(b, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", filename, err)
+	}
+
+	known := map[string]bool{}
+	for _, f := range fields() {
+		known[f.name] = true
+	}
+
+	values := map[string]string{}
+	for k, v := range raw {
+		if !known[k] {
+			return nil, fmt.Errorf("unknown setting %q in %s", k, filename)
+		}
+		values[k] = fmt.Sprint(v)
+	}
+
+	return values, nil
+}
+
+func checkURL(s string) error {
+	u, err := url.Parse(s)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("must be an http or https URL, not %q", s)
+	}
+	if u.Host == "" {
+		return fmt.Errorf("has no host: %q", s)
+	}
+
+	return nil
+}
+
+func checkPort(s string) error {
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 || n > 65535 {
+		return fmt.Errorf("must be a port number, not %q", s)
+	}
+
+	return nil
+}
+
+// field is a setting of Config
+type field struct {
+	name   string
+	index  []int
+	kind   reflect.Kind
+	secret bool
+}
+
+func fields() []field {
+	var out []field
+
+	t := reflect.TypeOf(Config{})
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		out = append(out, field{
+			name:   f.Tag.Get("config"),
+			index:  f.Index,
+			kind:   f.Type.Kind(),
+			secret: f.Tag.Get("log") == "secret",
+		})
+	}
+
+	return out
+}
+
+func (f field) envName() string {
+	return strings.ToUpper(f.name)
+}
+
+func (f field) flagName() string {
+	return strings.Replace(f.name, "_", "-", -1)
+}
+
+func (f field) usage() string {
+	return "overrides " + f.envName()
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+func (f field) set(v reflect.Value, s string) error {
+	switch {
+	case v.Type() == durationType:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+	case f.kind == reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case f.kind == reflect.Int:
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(n))
+	default:
+		v.SetString(s)
+	}
+
+	return nil
+}
+
+// flagValue records a flag for apply, so that flags are applied last
+type flagValue struct {
+	name   string
+	values map[string]string
+	isBool bool
+}
+
+func (f *flagValue) String() string {
+	if f == nil || f.values == nil {
+		return ""
+	}
+
+	return f.values[f.name]
+}
+
+func (f *flagValue) Set(s string) error {
+	f.values[f.name] = s
+	return nil
+}
+
+func (f *flagValue) IsBoolFlag() bool {
+	return f.isBool
+}
@@ -0,0 +1,228 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// setenv sets the environment variables and returns a function restoring
+// them
+func setenv(t *testing.T, env map[string]string) func() {
+	t.Helper()
+
+	old := map[string]*string{}
+	for k, v := range env {
+		if prev, ok := os.LookupEnv(k); ok {
+			old[k] = &prev
+		} else {
+			old[k] = nil
+		}
+		os.Setenv(k, v)
+	}
+
+	return func() {
+		for k, v := range old {
+			if v == nil {
+				os.Unsetenv(k)
+			} else {
+				os.Setenv(k, *v)
+			}
+		}
+	}
+}
+
+func writeFile(t *testing.T, pattern, content string) string {
+	t.Helper()
+
+	f, err := ioutil.TempFile("", pattern)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(content)
+	f.Close()
+
+	return f.Name()
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	file := writeFile(t, "config-*.yaml", `
+hydra_admin_url: http://hydra:4445
+port: 4000
+metrics_port: 9100
+log_level: warn
+logout_confirm: false
+lock_after: 3
+`)
+	defer os.Remove(file)
+
+	defer setenv(t, map[string]string{
+		"PORT":        "5000",
+		"LOG_LEVEL":   "error",
+		"SESSION_TTL": "1h",
+	})()
+
+	cfg, err := Load([]string{"-config", file, "-port", "6000", "-logout-confirm"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		got, want interface{}
+	}{
+		{"hydra_admin_url from the file", cfg.HydraAdminURL, "http://hydra:4445"},
+		{"metrics_port from the file", cfg.MetricsPort, "9100"},
+		{"lock_after from the file", cfg.LockAfter, 3},
+		{"log_level from the environment over the file", cfg.LogLevel, "error"},
+		{"session_ttl from the environment", cfg.SessionTTL, time.Hour},
+		{"port from the flags over the environment", cfg.Port, "6000"},
+		{"logout_confirm from the flags over the file", cfg.LogoutConfirm, true},
+		{"rate_limit_ip by default", cfg.RateLimitIP, "20/1m"},
+		{"root_url derived from port", cfg.RootURL, "http://localhost:6000"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+}
+
+func TestLoadFileFromTheEnvironment(t *testing.T) {
+	file := writeFile(t, "config-*.json", `{"hydra_admin_url": "https://hydra:4445", "debug": true}`)
+	defer os.Remove(file)
+	defer setenv(t, map[string]string{"CONFIG_FILE": file})()
+
+	cfg, err := Load(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.HydraAdminURL != "https://hydra:4445" {
+		t.Errorf("hydra_admin_url = %q, want the one in the file", cfg.HydraAdminURL)
+	}
+	if cfg.LogLevel != "debug" {
+		t.Errorf("log_level = %q, want debug with debug set", cfg.LogLevel)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	unknown := writeFile(t, "config-*.yaml", "hydra_admin_url: http://hydra:4445\nhydra_url: http://hydra:4444\n")
+	defer os.Remove(unknown)
+
+	tests := []struct {
+		name string
+		args []string
+		env  map[string]string
+		want string
+	}{
+		{"unknown setting in the file", []string{"-config", unknown}, nil, `unknown setting "hydra_url"`},
+		{"missing file", []string{"-config", unknown + ".missing"}, nil, "no such file"},
+		{"bad duration in the environment", []string{"-hydra-admin-url", "http://hydra:4445"}, map[string]string{"SESSION_TTL": "a month"}, "session_ttl from environment"},
+		{"bad number in the flags", []string{"-hydra-admin-url", "http://hydra:4445", "-lock-after", "ten"}, nil, "lock_after from flags"},
+		{"invalid result", nil, nil, "hydra_admin_url: is required"},
+	}
+
+	for _, tt := range tests {
+		restore := setenv(t, tt.env)
+		_, err := Load(tt.args)
+		restore()
+
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: got error %v, want one containing %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := func() Config {
+		cfg := Default()
+		cfg.HydraAdminURL = "http://hydra:4445"
+		cfg.RootURL = "https://login.example.com"
+		cfg.LogLevel = "info"
+		return cfg
+	}
+	if err := valid().Validate(); err != nil {
+		t.Fatalf("the defaults with hydra_admin_url are invalid: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		change func(*Config)
+		want   []string
+	}{
+		{"hydra admin url", func(c *Config) { c.HydraAdminURL = "hydra:4445" }, []string{"hydra_admin_url: must be an http or https URL"}},
+		{"root url without host", func(c *Config) { c.RootURL = "https://" }, []string{"root_url: has no host"}},
+		{"port", func(c *Config) { c.Port = "http" }, []string{"port: must be a port number"}},
+		{"same ports", func(c *Config) { c.MetricsPort = c.Port }, []string{"metrics_port: must differ from port"}},
+		{"session store", func(c *Config) { c.SessionStore = "redis" }, []string{"session_store: must be cookie, memory or sql"}},
+		{"sql without dsn", func(c *Config) { c.SessionStore = SessionStoreSQL }, []string{"session_store_dsn: is required"}},
+		{"key and key file", func(c *Config) { c.CookieStoreKey, c.CookieStoreKeyFile = "a", "b" }, []string{"cookie_store_key: must not be given together"}},
+		{"bad key", func(c *Config) { c.SessionStoreKey = "short" }, []string{"session_store_key: "}},
+		{"no keys in production", func(c *Config) { c.Production = true }, []string{"cookie_store_key: is required in production", "session_store_key: is required in production"}},
+		{"lock after", func(c *Config) { c.LockAfter = 0 }, []string{"lock_after: must be at least 1"}},
+		{"negative hsts", func(c *Config) { c.HSTSMaxAge = -time.Second }, []string{"hsts_max_age: must not be negative"}},
+		{"tls cert alone", func(c *Config) { c.TLSCertFile = "/dev/null" }, []string{"tls_cert_file: must be given together with tls_key_file"}},
+		{"missing file", func(c *Config) { c.ImportUsers = "/nonexistent/users.json" }, []string{"import_users: "}},
+		{"timeouts", func(c *Config) { c.ReadTimeout, c.LockWindow = 0, -time.Minute }, []string{"read_timeout: must be positive", "lock_window: must be positive"}},
+		{
+			"every problem at once",
+			func(c *Config) { c.HydraAdminURL, c.Port, c.LockAfter = "", "0", -1 },
+			[]string{"hydra_admin_url: is required", "port: must be a port number", "lock_after: must be at least 1"},
+		},
+	}
+
+	for _, tt := range tests {
+		cfg := valid()
+		tt.change(&cfg)
+
+		err := cfg.Validate()
+		if err == nil {
+			t.Errorf("%s: the configuration is valid", tt.name)
+			continue
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(err.Error(), "\n  "+want) {
+				t.Errorf("%s: got %v, want a line starting with %q", tt.name, err, want)
+			}
+		}
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	cfg := Default()
+	cfg.HydraAdminURL = "http://hydra:4445"
+	cfg.CookieStoreKey = "c2VjcmV0"
+	cfg.CookieStoreKeyFile = "/run/secrets/cookie"
+	cfg.SessionStoreDSN = "postgres://login:hunter2@db/login"
+	cfg.LogoutConfirm = true
+
+	got := cfg.Redacted()
+
+	want := map[string]string{
+		"hydra_admin_url":       "http://hydra:4445",
+		"cookie_store_key":      "[REDACTED]",
+		"cookie_store_key_file": "/run/secrets/cookie",
+		"session_store_dsn":     "[REDACTED]",
+		"session_store_key":     "",
+		"pairwise_salt":         "",
+		"logout_confirm":        "true",
+		"session_ttl":           "720h0m0s",
+		"lock_after":            "10",
+	}
+	for name, value := range want {
+		if got[name] != value {
+			t.Errorf("%s = %q, want %q", name, got[name], value)
+		}
+	}
+
+	if n := len(got); n != len(fields()) {
+		t.Errorf("got %d settings, want all %d", n, len(fields()))
+	}
+	for name, value := range got {
+		if strings.Contains(value, "hunter2") || strings.Contains(value, "c2VjcmV0") {
+			t.Errorf("%s = %q reveals a secret", name, value)
+		}
+	}
+}
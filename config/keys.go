@@ -0,0 +1,87 @@
+package config
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"unicode"
+)
+
+// KeyPair is a key to authenticate cookies with, and optionally one to
+// encrypt them with
+type KeyPair struct {
+	Hash  []byte
+	Block []byte
+}
+
+// ParseKeys parses a comma separated list of keys, the current one first and
+// then the previous ones, which are only used to read cookies written before
+// a rotation. Each key is a base64-encoded hash key of 32 or 64 bytes,
+// optionally followed by a colon and a base64-encoded block key of 16, 24 or
+// 32 bytes. Whitespace is ignored, so keys may be wrapped.
+func ParseKeys(s string) ([]KeyPair, error) {
+	s = strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return -1
+		}
+		return r
+	}, s)
+	if s == "" {
+		return nil, nil
+	}
+
+	var pairs []KeyPair
+	for i, entry := range strings.Split(s, ",") {
+		parts := strings.Split(entry, ":")
+		if len(parts) > 2 {
+			return nil, fmt.Errorf("key %d has more than a hash and a block key", i+1)
+		}
+
+		hash, err := base64.StdEncoding.DecodeString(parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("key %d must be base64-encoded", i+1)
+		}
+		if len(hash) != 32 && len(hash) != 64 {
+			return nil, fmt.Errorf("key %d must be 32 or 64 bytes long, not %d", i+1, len(hash))
+		}
+		pair := KeyPair{Hash: hash}
+
+		if len(parts) == 2 {
+			if pair.Block, err = base64.StdEncoding.DecodeString(parts[1]); err != nil {
+				return nil, fmt.Errorf("block key %d must be base64-encoded", i+1)
+			}
+			if n := len(pair.Block); n != 16 && n != 24 && n != 32 {
+				return nil, fmt.Errorf("block key %d must be 16, 24 or 32 bytes long, not %d", i+1, n)
+			}
+		}
+
+		pairs = append(pairs, pair)
+	}
+
+	return pairs, nil
+}
+
+// CookieKeys are the keys of the remember me cookies
+func (c Config) CookieKeys() ([]KeyPair, error) {
+	return loadKeys(c.CookieStoreKey, c.CookieStoreKeyFile)
+}
+
+// SessionKeys are the keys of the session cookie
+func (c Config) SessionKeys() ([]KeyPair, error) {
+	return loadKeys(c.SessionStoreKey, c.SessionStoreKeyFile)
+}
+
+// loadKeys parses the keys given as a setting or, such as when mounted from
+// a Kubernetes secret, in a file
+func loadKeys(keys, filename string) ([]KeyPair, error) {
+	if filename != "" {
+		b, err := ioutil.ReadFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		keys = string(b)
+	}
+
+	return ParseKeys(keys)
+}
@@ -0,0 +1,91 @@
+package config
+
+import (
+	"bytes"
+	"encoding/base64"
+	"os"
+	"strings"
+	"testing"
+)
+
+func key(n int, b byte) string {
+	return base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{b}, n))
+}
+
+func TestParseKeys(t *testing.T) {
+	current, previous, block := key(64, 1), key(32, 2), key(32, 3)
+
+	tests := []struct {
+		name   string
+		keys   string
+		hashes []int
+		blocks []int
+	}{
+		{"none", "", nil, nil},
+		{"one", current, []int{64}, []int{0}},
+		{"with a block key", current + ":" + block, []int{64}, []int{32}},
+		{"rotated", current + ":" + key(16, 4) + "," + previous, []int{64, 32}, []int{16, 0}},
+		{"wrapped", current[:40] + "\n  " + current[40:] + " ,\n" + previous + "\n", []int{64, 32}, []int{0, 0}},
+	}
+
+	for _, tt := range tests {
+		keys, err := ParseKeys(tt.keys)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if len(keys) != len(tt.hashes) {
+			t.Errorf("%s: got %d keys, want %d", tt.name, len(keys), len(tt.hashes))
+			continue
+		}
+		for i, k := range keys {
+			if len(k.Hash) != tt.hashes[i] || len(k.Block) != tt.blocks[i] {
+				t.Errorf("%s: key %d has a %d byte hash key and a %d byte block key, want %d and %d",
+					tt.name, i+1, len(k.Hash), len(k.Block), tt.hashes[i], tt.blocks[i])
+			}
+		}
+	}
+
+	// The current key comes first
+	keys, _ := ParseKeys(current + "," + previous)
+	if keys[0].Hash[0] != 1 || keys[1].Hash[0] != 2 {
+		t.Error("the keys are not in the order given")
+	}
+
+	for _, tt := range []struct{ keys, want string }{
+		{"not base64!", "key 1 must be base64-encoded"},
+		{current + "," + key(48, 1), "key 2 must be 32 or 64 bytes long, not 48"},
+		{current + ":" + key(20, 1), "block key 1 must be 16, 24 or 32 bytes long, not 20"},
+		{current + ":!!", "block key 1 must be base64-encoded"},
+		{current + ":" + block + ":" + block, "key 1 has more than a hash and a block key"},
+		{current + ",", "key 2 must be 32 or 64 bytes long, not 0"},
+	} {
+		if _, err := ParseKeys(tt.keys); err == nil || err.Error() != tt.want {
+			t.Errorf("ParseKeys(%q) returned %v, want %q", tt.keys, err, tt.want)
+		}
+	}
+}
+
+func TestKeysFromFile(t *testing.T) {
+	file := writeFile(t, "keys-*", key(64, 1)+":"+key(32, 3)+",\n"+key(64, 2)+"\n")
+	defer os.Remove(file)
+
+	cfg := Config{SessionStoreKeyFile: file, CookieStoreKey: key(32, 4)}
+
+	keys, err := cfg.SessionKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 || keys[0].Hash[0] != 1 || len(keys[0].Block) != 32 || keys[1].Hash[0] != 2 {
+		t.Errorf("loaded %d keys from the file, want the two in it", len(keys))
+	}
+
+	if keys, err := cfg.CookieKeys(); err != nil || len(keys) != 1 || keys[0].Hash[0] != 4 {
+		t.Errorf("CookieKeys() = %v, %v, want the key of the setting", keys, err)
+	}
+
+	cfg.SessionStoreKeyFile = file + ".missing"
+	if _, err := cfg.SessionKeys(); err == nil || !strings.Contains(err.Error(), "no such file") {
+		t.Errorf("got %v for a missing file", err)
+	}
+}
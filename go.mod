@@ -1,19 +1,21 @@
 module github.com/nbycomp/login-consent
 
 require (
-	github.com/davecgh/go-spew v1.1.1
 	github.com/go-chi/chi v4.0.2+incompatible
-	github.com/gorilla/schema v1.1.0
+	github.com/google/uuid v1.1.1
 	github.com/gorilla/securecookie v1.1.1
 	github.com/gorilla/sessions v1.2.0
 	github.com/justinas/nosurf v0.0.0-20190416172904-05988550ea18
+	github.com/lib/pq v1.10.9
 	github.com/pkg/errors v0.8.1
 	github.com/pquerna/otp v1.2.0 // indirect
+	github.com/prometheus/client_golang v1.7.1
 	github.com/volatiletech/authboss v2.3.0+incompatible
 	github.com/volatiletech/authboss-clientstate v0.0.0-20190330222254-a25680a62c98
 	github.com/volatiletech/authboss-renderer v0.0.0-20181105062701-4b64de40529a
 	golang.org/x/crypto v0.0.0-20190701094942-4def268fd1a4 // indirect
 	golang.org/x/oauth2 v0.0.0-20190604053449-0f29369cfe45 // indirect
+	gopkg.in/yaml.v2 v2.2.5
 )
 
 go 1.13
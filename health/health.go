@@ -0,0 +1,165 @@
+// Package health serves the liveness and readiness probes of the service.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Check reports whether a dependency is usable
+type Check func(ctx context.Context) error
+
+// Timeout bounds the time the readiness checks may take together
+const Timeout = 3 * time.Second
+
+// Status of a check
+const (
+	StatusOK          = "ok"
+	StatusUnavailable = "unavailable"
+	StatusPending     = "pending"
+)
+
+// Result of a check, as reported by the readiness probe
+type Result struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Report is the body of the readiness probe
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]Result `json:"checks"`
+}
+
+// Checker runs the readiness checks
+type Checker struct {
+	mu     sync.RWMutex
+	checks map[string]Check
+	gates  map[string]*Gate
+}
+
+// NewChecker creates a Checker without checks
+func NewChecker() *Checker {
+	return &Checker{
+		checks: map[string]Check{},
+		gates:  map[string]*Gate{},
+	}
+}
+
+// Add a check run on every readiness probe
+func (c *Checker) Add(name string, check Check) {
+	c.mu.Lock()
+	c.checks[name] = check
+	c.mu.Unlock()
+}
+
+// Gate adds a check that stays pending until the returned gate is opened,
+// for work that must finish once before the service can take traffic.
+func (c *Checker) Gate(name string) *Gate {
+	g := &Gate{}
+
+	c.mu.Lock()
+	c.gates[name] = g
+	c.mu.Unlock()
+
+	return g
+}
+
+// Run the checks concurrently
+func (c *Checker) Run(ctx context.Context) Report {
+	ctx, cancel := context.WithTimeout(ctx, Timeout)
+	defer cancel()
+
+	report := Report{Status: StatusOK, Checks: map[string]Result{}}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	for name, g := range c.gates {
+		if g.IsOpen() {
+			report.Checks[name] = Result{Status: StatusOK}
+		} else {
+			report.Checks[name] = Result{Status: StatusPending}
+		}
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range c.checks {
+		wg.Add(1)
+		go func(name string, check Check) {
+			defer wg.Done()
+
+			res := Result{Status: StatusOK}
+			if err := check(ctx); err != nil {
+				res = Result{Status: StatusUnavailable, Error: err.Error()}
+			}
+
+			mu.Lock()
+			report.Checks[name] = res
+			mu.Unlock()
+		}(name, check)
+	}
+	wg.Wait()
+
+	for _, res := range report.Checks {
+		if res.Status != StatusOK {
+			report.Status = StatusUnavailable
+		}
+	}
+
+	return report
+}
+
+// Ready serves the readiness probe: the result of every check, with status
+// 503 unless they all passed
+func (c *Checker) Ready() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := c.Run(r.Context())
+
+		status := http.StatusOK
+		if report.Status != StatusOK {
+			status = http.StatusServiceUnavailable
+		}
+		writeJSON(w, status, report)
+	})
+}
+
+// Alive serves the liveness probe, which passes as long as the process can
+// answer
+func Alive() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, Result{Status: StatusOK})
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// Gate is a readiness check that passes once opened
+type Gate struct {
+	mu   sync.RWMutex
+	open bool
+}
+
+// Open the gate
+func (g *Gate) Open() {
+	g.mu.Lock()
+	g.open = true
+	g.mu.Unlock()
+}
+
+// IsOpen reports whether the gate was opened
+func (g *Gate) IsOpen() bool {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	return g.open
+}
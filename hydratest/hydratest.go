@@ -0,0 +1,292 @@
+// Package hydratest provides a fake Hydra admin API, so the login and consent
+// flows can be exercised without a Hydra instance. Login, consent and logout
+// requests are registered by challenge, and every call made to the server is
+// recorded with its body for the caller to inspect.
+package hydratest
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/nbycomp/login-consent/login"
+)
+
+// RedirectURL is where the fake sends the browser after a request has been
+// accepted or rejected, with the flow and challenge in the query
+const RedirectURL = "http://hydra.test/oauth2/auth"
+
+// ConsentRequest is the consent request returned by the admin API
+type ConsentRequest struct {
+	Challenge                    string                 `json:"challenge"`
+	Subject                      string                 `json:"subject"`
+	Client                       login.Client           `json:"client"`
+	Skip                         bool                   `json:"skip"`
+	RequestURL                   string                 `json:"request_url"`
+	RequestedScope               []string               `json:"requested_scope"`
+	RequestedAccessTokenAudience []string               `json:"requested_access_token_audience"`
+	Context                      map[string]interface{} `json:"context"`
+}
+
+// LogoutRequest is the logout request returned by the admin API
+type LogoutRequest struct {
+	Subject     string `json:"subject"`
+	SessionID   string `json:"sid"`
+	RequestURL  string `json:"request_url"`
+	RPInitiated bool   `json:"rp_initiated"`
+}
+
+// Call is a request made to the fake
+type Call struct {
+	Method string
+	Path   string
+	Query  url.Values
+	Body   []byte
+}
+
+// Decode unmarshals the JSON body of the call
+func (c Call) Decode(v interface{}) error {
+	return json.Unmarshal(c.Body, v)
+}
+
+// Server is a fake Hydra admin API listening on a local port
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	logins   map[string]login.LoginRequest
+	consents map[string]ConsentRequest
+	logouts  map[string]LogoutRequest
+	sessions map[string][]login.ConsentSession
+	handled  map[string]bool
+	failures map[string]int
+	calls    []Call
+}
+
+// NewServer starts a fake with no requests. Close it when done.
+func NewServer() *Server {
+	s := &Server{
+		logins:   map[string]login.LoginRequest{},
+		consents: map[string]ConsentRequest{},
+		logouts:  map[string]LogoutRequest{},
+		sessions: map[string][]login.ConsentSession{},
+		handled:  map[string]bool{},
+		failures: map[string]int{},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+
+	return s
+}
+
+// AddLogin registers a login request under its challenge. Set Skip and
+// Subject to have the fake report that it remembers the user.
+func (s *Server) AddLogin(req login.LoginRequest) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.logins[req.Challenge] = req
+	delete(s.handled, "login:"+req.Challenge)
+}
+
+// AddConsent registers a consent request under its challenge
+func (s *Server) AddConsent(req ConsentRequest) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.consents[req.Challenge] = req
+	delete(s.handled, "consent:"+req.Challenge)
+}
+
+// AddLogout registers a logout request under challenge
+func (s *Server) AddLogout(challenge string, req LogoutRequest) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.logouts[challenge] = req
+	delete(s.handled, "logout:"+challenge)
+}
+
+// AddConsentSession records that subject granted access to a client, as
+// listed on the connected applications page
+func (s *Server) AddConsentSession(subject string, session login.ConsentSession) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sessions[subject] = append(s.sessions[subject], session)
+}
+
+// Fail makes calls with method to path answer with status, for example
+// Fail(http.MethodPut, "/oauth2/auth/requests/login/accept", 500). A status
+// of 0 makes them succeed again.
+func (s *Server) Fail(method, path string, status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if status == 0 {
+		delete(s.failures, method+" "+path)
+		return
+	}
+	s.failures[method+" "+path] = status
+}
+
+// Calls returns the calls made so far, oldest first
+func (s *Server) Calls() []Call {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Call(nil), s.calls...)
+}
+
+// Accepted returns the body with which the login, consent or logout request
+// with challenge was accepted
+func (s *Server) Accepted(flow, challenge string) (Call, bool) {
+	return s.find(http.MethodPut, "/oauth2/auth/requests/"+flow+"/accept", flow, challenge)
+}
+
+// Rejected returns the body with which the login, consent or logout request
+// with challenge was rejected
+func (s *Server) Rejected(flow, challenge string) (Call, bool) {
+	return s.find(http.MethodPut, "/oauth2/auth/requests/"+flow+"/reject", flow, challenge)
+}
+
+// Reset forgets the requests, sessions, failures and calls
+func (s *Server) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.logins = map[string]login.LoginRequest{}
+	s.consents = map[string]ConsentRequest{}
+	s.logouts = map[string]LogoutRequest{}
+	s.sessions = map[string][]login.ConsentSession{}
+	s.handled = map[string]bool{}
+	s.failures = map[string]int{}
+	s.calls = nil
+}
+
+func (s *Server) find(method, path, flow, challenge string) (Call, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := len(s.calls) - 1; i >= 0; i-- {
+		c := s.calls[i]
+		if c.Method == method && c.Path == path && c.Query.Get(flow+"_challenge") == challenge {
+			return c, true
+		}
+	}
+
+	return Call{}, false
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.calls = append(s.calls, Call{Method: r.Method, Path: r.URL.Path, Query: r.URL.Query(), Body: body})
+
+	if status, ok := s.failures[r.Method+" "+r.URL.Path]; ok {
+		writeError(w, status, "failure requested by the test")
+		return
+	}
+
+	if r.URL.Path == "/health/ready" && r.Method == http.MethodGet {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+		return
+	}
+
+	if strings.HasPrefix(r.URL.Path, "/oauth2/auth/sessions/") {
+		s.serveSessions(w, r)
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/oauth2/auth/requests/"), "/")
+	if len(parts) == 0 || len(parts) > 2 || !strings.HasPrefix(r.URL.Path, "/oauth2/auth/requests/") {
+		writeError(w, http.StatusNotFound, "unknown path")
+		return
+	}
+
+	flow := parts[0]
+	challenge := r.URL.Query().Get(flow + "_challenge")
+
+	var req interface{}
+	var ok bool
+	switch flow {
+	case "login":
+		req, ok = s.logins[challenge]
+	case "consent":
+		req, ok = s.consents[challenge]
+	case "logout":
+		req, ok = s.logouts[challenge]
+	}
+	if !ok {
+		writeError(w, http.StatusNotFound, "unknown "+flow+" challenge")
+		return
+	}
+
+	switch {
+	case len(parts) == 1 && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, req)
+	case len(parts) == 2 && r.Method == http.MethodPut && (parts[1] == "accept" || parts[1] == "reject"):
+		if s.handled[flow+":"+challenge] {
+			writeError(w, http.StatusConflict, "the "+flow+" request has already been handled")
+			return
+		}
+		s.handled[flow+":"+challenge] = true
+
+		q := url.Values{}
+		q.Set(flow+"_verifier", challenge)
+		q.Set("result", parts[1])
+		writeJSON(w, http.StatusOK, map[string]string{"redirect_to": RedirectURL + "?" + q.Encode()})
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "unsupported method")
+	}
+}
+
+// serveSessions lists and revokes the sessions of a subject. Revoking the
+// consent sessions drops them from the list.
+func (s *Server) serveSessions(w http.ResponseWriter, r *http.Request) {
+	subject := r.URL.Query().Get("subject")
+
+	switch {
+	case r.URL.Path == "/oauth2/auth/sessions/consent" && r.Method == http.MethodGet:
+		sessions := s.sessions[subject]
+		if sessions == nil {
+			sessions = []login.ConsentSession{}
+		}
+		writeJSON(w, http.StatusOK, sessions)
+	case r.URL.Path == "/oauth2/auth/sessions/consent" && r.Method == http.MethodDelete:
+		client := r.URL.Query().Get("client")
+		var kept []login.ConsentSession
+		for _, cs := range s.sessions[subject] {
+			if client != "" && cs.ConsentRequest.Client.ClientID != client {
+				kept = append(kept, cs)
+			}
+		}
+		s.sessions[subject] = kept
+		w.WriteHeader(http.StatusNoContent)
+	case r.URL.Path == "/oauth2/auth/sessions/login" && r.Method == http.MethodDelete:
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusNotFound, "unknown path")
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError answers in the format of Hydra's errors
+func writeError(w http.ResponseWriter, status int, description string) {
+	writeJSON(w, status, map[string]interface{}{
+		"error":             http.StatusText(status),
+		"error_description": description,
+		"status_code":       status,
+	})
+}
@@ -0,0 +1,81 @@
+package i18n
+
+var en = Catalog{
+	"lang_name": "English",
+
+	"login_title":        "Log in",
+	"login_logo_alt":     "Nearby Computing logo",
+	"login_email":        "E-mail",
+	"login_password":     "Password",
+	"login_remember_me":  "Remember Me",
+	"login_submit":       "Login",
+	"login_recover":      "Recover Account",
+	"login_register":     "Register Account",
+	"login_continue_to":  "to continue to",
+	"login_mfa_required": "This application requires two-factor authentication. Set up a second factor for your account and try again.",
+	"login_disabled":     "This account has been disabled.",
+	"login_locked":       "This account is locked after too many failed attempts. Try again later.",
+
+	"consent_title":  "Authorize application",
+	"consent_failed": "The application could not be authorized.",
+
+	"logout_title":      "Log out",
+	"logout_question":   "Do you want to log out?",
+	"logout_yes":        "Yes",
+	"logout_no":         "No",
+	"logout_everywhere": "Also sign out of every application",
+
+	"apps_title":      "Connected applications",
+	"apps_none":       "You have not given any application access to your account.",
+	"apps_scopes":     "Access",
+	"apps_granted":    "Granted on",
+	"apps_revoke":     "Revoke access",
+	"apps_revoke_all": "Revoke access for all applications",
+	"apps_revoked":    "Access has been revoked.",
+
+	"account_title":             "Your account",
+	"account_name":              "Name",
+	"account_name_required":     "Please enter your name.",
+	"account_name_saved":        "Your name has been updated.",
+	"account_password":          "Password",
+	"account_current_password":  "Current password",
+	"account_new_password":      "New password",
+	"account_confirm_password":  "Confirm new password",
+	"account_password_wrong":    "The current password is incorrect.",
+	"account_password_required": "Please enter a new password.",
+	"account_password_mismatch": "The new passwords do not match.",
+	"account_password_saved":    "Your password has been changed.",
+	"account_save":              "Save",
+	"account_totp_setup":        "Set up an authenticator app",
+	"account_totp_remove":       "Remove the authenticator app",
+	"account_recovery_codes":    "Regenerate recovery codes",
+	"account_activity":          "Recent activity",
+	"account_no_activity":       "No logins recorded yet.",
+
+	"error_title":        "Error",
+	"error_heading":      "Something went wrong",
+	"error_generic":      "An unexpected error occurred. Please try again.",
+	"error_hydra":        "The authorization server could not be reached. Please try again later.",
+	"error_no_challenge": "This page must be reached through an application's sign-in flow.",
+	"error_rate_limited": "Too many attempts. Please wait a minute and try again.",
+
+	"twofa_title":          "Two-factor authentication",
+	"twofa_setup":          "Setup two-factor authentication",
+	"twofa_begin_setup":    "Begin Setup",
+	"twofa_code":           "Code",
+	"twofa_recovery_code":  "Recovery Code",
+	"twofa_recovery_codes": "Recovery Codes",
+	"twofa_ok":             "Ok",
+	"twofa_verify":         "Authorize adding 2fa to your account",
+
+	"totp_confirm":         "Confirm your authenticator code to complete setup",
+	"totp_qr_alt":          "2fa setup qr code",
+	"totp_key":             "Key",
+	"totp_enabled":         "Authenticator two-factor enabled",
+	"totp_remove":          "Confirm your authenticator code to remove 2fa from your account",
+	"totp_removed":         "Authenticator two-factor successfully removed from account",
+	"totp_validate":        "Enter your authenticator code",
+	"recovery_regenerated": "Recovery codes regenerated",
+	"recovery_remaining":   "recovery codes remaining.",
+	"recovery_regenerate":  "Regenerate",
+}
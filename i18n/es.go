@@ -0,0 +1,81 @@
+package i18n
+
+var es = Catalog{
+	"lang_name": "Español",
+
+	"login_title":        "Iniciar sesión",
+	"login_logo_alt":     "Logotipo de Nearby Computing",
+	"login_email":        "Correo electrónico",
+	"login_password":     "Contraseña",
+	"login_remember_me":  "Recordarme",
+	"login_submit":       "Entrar",
+	"login_recover":      "Recuperar cuenta",
+	"login_register":     "Crear cuenta",
+	"login_continue_to":  "para continuar a",
+	"login_mfa_required": "Esta aplicación requiere verificación en dos pasos. Configura un segundo factor en tu cuenta e inténtalo de nuevo.",
+	"login_disabled":     "Esta cuenta ha sido desactivada.",
+	"login_locked":       "Esta cuenta está bloqueada tras demasiados intentos fallidos. Inténtalo de nuevo más tarde.",
+
+	"consent_title":  "Autorizar aplicación",
+	"consent_failed": "No se ha podido autorizar la aplicación.",
+
+	"logout_title":      "Cerrar sesión",
+	"logout_question":   "¿Quieres cerrar la sesión?",
+	"logout_yes":        "Sí",
+	"logout_no":         "No",
+	"logout_everywhere": "Cerrar también la sesión en todas las aplicaciones",
+
+	"apps_title":      "Aplicaciones conectadas",
+	"apps_none":       "No has dado acceso a tu cuenta a ninguna aplicación.",
+	"apps_scopes":     "Acceso",
+	"apps_granted":    "Concedido el",
+	"apps_revoke":     "Revocar acceso",
+	"apps_revoke_all": "Revocar el acceso de todas las aplicaciones",
+	"apps_revoked":    "Se ha revocado el acceso.",
+
+	"account_title":             "Tu cuenta",
+	"account_name":              "Nombre",
+	"account_name_required":     "Introduce tu nombre.",
+	"account_name_saved":        "Se ha actualizado tu nombre.",
+	"account_password":          "Contraseña",
+	"account_current_password":  "Contraseña actual",
+	"account_new_password":      "Nueva contraseña",
+	"account_confirm_password":  "Confirma la nueva contraseña",
+	"account_password_wrong":    "La contraseña actual no es correcta.",
+	"account_password_required": "Introduce una nueva contraseña.",
+	"account_password_mismatch": "Las nuevas contraseñas no coinciden.",
+	"account_password_saved":    "Se ha cambiado tu contraseña.",
+	"account_save":              "Guardar",
+	"account_totp_setup":        "Configurar una aplicación de autenticación",
+	"account_totp_remove":       "Quitar la aplicación de autenticación",
+	"account_recovery_codes":    "Regenerar los códigos de recuperación",
+	"account_activity":          "Actividad reciente",
+	"account_no_activity":       "Todavía no hay inicios de sesión registrados.",
+
+	"error_title":        "Error",
+	"error_heading":      "Algo ha ido mal",
+	"error_generic":      "Se ha producido un error inesperado. Inténtalo de nuevo.",
+	"error_hydra":        "No se ha podido contactar con el servidor de autorización. Inténtalo más tarde.",
+	"error_no_challenge": "Solo se puede acceder a esta página desde el inicio de sesión de una aplicación.",
+	"error_rate_limited": "Demasiados intentos. Espera un minuto e inténtalo de nuevo.",
+
+	"twofa_title":          "Verificación en dos pasos",
+	"twofa_setup":          "Configurar la verificación en dos pasos",
+	"twofa_begin_setup":    "Empezar",
+	"twofa_code":           "Código",
+	"twofa_recovery_code":  "Código de recuperación",
+	"twofa_recovery_codes": "Códigos de recuperación",
+	"twofa_ok":             "Aceptar",
+	"twofa_verify":         "Autoriza la verificación en dos pasos para tu cuenta",
+
+	"totp_confirm":         "Introduce el código de tu aplicación de autenticación para completar la configuración",
+	"totp_qr_alt":          "código QR de configuración",
+	"totp_key":             "Clave",
+	"totp_enabled":         "Verificación con aplicación de autenticación activada",
+	"totp_remove":          "Introduce el código de tu aplicación de autenticación para desactivar la verificación en dos pasos",
+	"totp_removed":         "Verificación con aplicación de autenticación desactivada",
+	"totp_validate":        "Introduce el código de tu aplicación de autenticación",
+	"recovery_regenerated": "Códigos de recuperación regenerados",
+	"recovery_remaining":   "códigos de recuperación restantes.",
+	"recovery_regenerate":  "Regenerar",
+}
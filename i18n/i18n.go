@@ -0,0 +1,158 @@
+// Package i18n holds the message catalogs used by the rendered pages and
+// picks the locale to use for each request.
+package i18n
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Catalog maps message keys to translated strings. Keys use underscores so
+// templates can reach them with plain field syntax, e.g. {{.t.login_email}}.
+type Catalog map[string]string
+
+type contextKey string
+
+const (
+	// CTXKeyLocale holds the locale selected for the request
+	CTXKeyLocale contextKey = "locale"
+
+	// CookieName is the cookie holding the locale explicitly chosen by the user
+	CookieName = "lang"
+
+	// Default is used when nothing the client asks for is supported
+	Default = "en"
+)
+
+var catalogs = map[string]Catalog{
+	"en": en,
+	"es": es,
+}
+
+// Get returns the catalog for lang, falling back to the default catalog
+func Get(lang string) Catalog {
+	if c, ok := catalogs[lang]; ok {
+		return c
+	}
+
+	return catalogs[Default]
+}
+
+// T translates key in the locale selected for the request
+func T(r *http.Request, key string) string {
+	return Get(FromContext(r.Context()))[key]
+}
+
+// FromContext returns the locale stored by the middleware, or the default
+func FromContext(ctx context.Context) string {
+	if lang, ok := ctx.Value(CTXKeyLocale).(string); ok {
+		return lang
+	}
+
+	return Default
+}
+
+// WithLocale stores lang on the request context
+func WithLocale(r *http.Request, lang string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), CTXKeyLocale, lang))
+}
+
+// Match returns the first supported locale from a list of language tags in
+// order of preference. Region subtags fall back to their base language.
+func Match(tags ...string) (string, bool) {
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" {
+			continue
+		}
+		if _, ok := catalogs[tag]; ok {
+			return tag, true
+		}
+		if i := strings.IndexAny(tag, "-_"); i > 0 {
+			if _, ok := catalogs[tag[:i]]; ok {
+				return tag[:i], true
+			}
+		}
+	}
+
+	return "", false
+}
+
+// Negotiate picks the locale for a request, preferring the locale cookie
+// over the Accept-Language header.
+func Negotiate(r *http.Request) string {
+	if c, err := r.Cookie(CookieName); err == nil {
+		if lang, ok := Match(c.Value); ok {
+			return lang
+		}
+	}
+
+	if lang, ok := Match(parseAcceptLanguage(r.Header.Get("Accept-Language"))...); ok {
+		return lang
+	}
+
+	return Default
+}
+
+// Middleware selects the locale for every request. A "lang" query parameter
+// switches the locale and remembers the choice in a cookie.
+func Middleware(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if lang, ok := Match(r.URL.Query().Get(CookieName)); ok {
+			http.SetCookie(w, &http.Cookie{
+				Name:     CookieName,
+				Value:    lang,
+				Path:     "/",
+				MaxAge:   365 * 24 * 60 * 60,
+				HttpOnly: true,
+			})
+			r = WithLocale(r, lang)
+		} else {
+			r = WithLocale(r, Negotiate(r))
+		}
+
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// parseAcceptLanguage returns the language tags of an Accept-Language header
+// ordered by their quality value.
+func parseAcceptLanguage(header string) []string {
+	type weighted struct {
+		tag string
+		q   float64
+	}
+
+	var langs []weighted
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		if fields[0] == "" || fields[0] == "*" {
+			continue
+		}
+
+		q := 1.0
+		for _, f := range fields[1:] {
+			f = strings.TrimSpace(f)
+			if strings.HasPrefix(f, "q=") {
+				if v, err := strconv.ParseFloat(f[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		if q > 0 {
+			langs = append(langs, weighted{fields[0], q})
+		}
+	}
+
+	sort.SliceStable(langs, func(i, j int) bool { return langs[i].q > langs[j].q })
+
+	tags := make([]string, len(langs))
+	for i, l := range langs {
+		tags[i] = l.tag
+	}
+
+	return tags
+}
@@ -0,0 +1,77 @@
+package i18n
+
+import (
+	"sort"
+	"testing"
+)
+
+func TestCatalogsHaveTheSameKeys(t *testing.T) {
+	for lang, c := range catalogs {
+		if lang == Default {
+			continue
+		}
+
+		for _, key := range sortedKeys(catalogs[Default]) {
+			if _, ok := c[key]; !ok {
+				t.Errorf("catalog %s is missing key %s", lang, key)
+			}
+		}
+		for _, key := range sortedKeys(c) {
+			if _, ok := catalogs[Default][key]; !ok {
+				t.Errorf("catalog %s has key %s, which %s does not", lang, key, Default)
+			}
+		}
+	}
+}
+
+func TestCatalogsHaveNoEmptyMessages(t *testing.T) {
+	for lang, c := range catalogs {
+		for _, key := range sortedKeys(c) {
+			if c[key] == "" {
+				t.Errorf("catalog %s has an empty message for %s", lang, key)
+			}
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	for _, tt := range []struct {
+		tags []string
+		want string
+		ok   bool
+	}{
+		{[]string{"es"}, "es", true},
+		{[]string{"ES-mx"}, "es", true},
+		{[]string{"fr", "es_AR", "en"}, "es", true},
+		{[]string{"fr", ""}, "", false},
+		{nil, "", false},
+	} {
+		got, ok := Match(tt.tags...)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("Match(%q) = %q, %v, want %q, %v", tt.tags, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestParseAcceptLanguage(t *testing.T) {
+	got := parseAcceptLanguage("fr;q=0.5, es-ES, *;q=0.1, de;q=0, en;q=0.8")
+	want := []string{"es-ES", "en", "fr"}
+	if len(got) != len(want) {
+		t.Fatalf("parseAcceptLanguage = %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("parseAcceptLanguage = %q, want %q", got, want)
+		}
+	}
+}
+
+func sortedKeys(c Catalog) []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
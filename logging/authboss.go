@@ -0,0 +1,51 @@
+package logging
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/volatiletech/authboss"
+)
+
+// Authboss adapts the loggers on request contexts for authboss. Lines
+// logged outside of a request go to Logger, and are discarded when it is nil.
+type Authboss struct {
+	Logger *Logger
+}
+
+var (
+	_ authboss.Logger        = Authboss{}
+	_ authboss.ContextLogger = Authboss{}
+	_ authboss.RequestLogger = Authboss{}
+)
+
+// Info logs at info level
+func (a Authboss) Info(msg string) { a.logger().Info(msg) }
+
+// Error logs at error level
+func (a Authboss) Error(msg string) { a.logger().Error(msg) }
+
+func (a Authboss) logger() *Logger {
+	if a.Logger != nil {
+		return a.Logger
+	}
+
+	return discard
+}
+
+// FromContext returns an authboss logger for the context
+func (Authboss) FromContext(ctx context.Context) authboss.Logger {
+	return authbossLogger{FromContext(ctx)}
+}
+
+// FromRequest returns an authboss logger for the request
+func (Authboss) FromRequest(r *http.Request) authboss.Logger {
+	return authbossLogger{FromContext(r.Context())}
+}
+
+type authbossLogger struct {
+	l *Logger
+}
+
+func (a authbossLogger) Info(msg string)  { a.l.Info(msg) }
+func (a authbossLogger) Error(msg string) { a.l.Error(msg) }
@@ -0,0 +1,294 @@
+// Package logging writes leveled, structured log lines as JSON or logfmt and
+// carries a request scoped logger through the context.
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level of a log line
+type Level int
+
+// Levels
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "debug"
+	case LevelInfo:
+		return "info"
+	case LevelWarn:
+		return "warn"
+	default:
+		return "error"
+	}
+}
+
+// ParseLevel parses a level name, defaulting to info
+func ParseLevel(s string) (Level, error) {
+	switch strings.ToLower(s) {
+	case "debug":
+		return LevelDebug, nil
+	case "", "info":
+		return LevelInfo, nil
+	case "warn", "warning":
+		return LevelWarn, nil
+	case "error":
+		return LevelError, nil
+	}
+
+	return LevelInfo, fmt.Errorf("unknown log level %q", s)
+}
+
+// Output formats
+const (
+	FormatJSON   = "json"
+	FormatLogfmt = "logfmt"
+)
+
+// sink is shared by a logger and everything derived from it
+type sink struct {
+	mu     sync.Mutex
+	out    io.Writer
+	level  Level
+	format string
+}
+
+// Logger writes log lines with a set of fields attached
+type Logger struct {
+	sink *sink
+
+	mu     *sync.RWMutex
+	fields map[string]interface{}
+}
+
+// New creates a logger writing lines of at least level to out
+func New(out io.Writer, level Level, format string) *Logger {
+	if format != FormatLogfmt {
+		format = FormatJSON
+	}
+
+	return &Logger{
+		sink:   &sink{out: out, level: level, format: format},
+		mu:     &sync.RWMutex{},
+		fields: map[string]interface{}{},
+	}
+}
+
+// discard is used when no logger was put on the context
+var discard = New(ioutil.Discard, LevelError, FormatJSON)
+
+// With returns a logger that adds the key-value pairs to every line
+func (l *Logger) With(kv ...interface{}) *Logger {
+	l.mu.RLock()
+	fields := make(map[string]interface{}, len(l.fields)+len(kv)/2)
+	for k, v := range l.fields {
+		fields[k] = v
+	}
+	l.mu.RUnlock()
+
+	addFields(fields, kv)
+
+	return &Logger{sink: l.sink, mu: &sync.RWMutex{}, fields: fields}
+}
+
+// Add attaches the key-value pairs to this logger in place, so that they
+// also appear on lines written by whoever else holds it
+func (l *Logger) Add(kv ...interface{}) {
+	l.mu.Lock()
+	addFields(l.fields, kv)
+	l.mu.Unlock()
+}
+
+// Enabled reports whether lines of the level are written
+func (l *Logger) Enabled(level Level) bool {
+	return level >= l.sink.level
+}
+
+// Debug logs at debug level
+func (l *Logger) Debug(msg string, kv ...interface{}) { l.Log(LevelDebug, msg, kv...) }
+
+// Info logs at info level
+func (l *Logger) Info(msg string, kv ...interface{}) { l.Log(LevelInfo, msg, kv...) }
+
+// Warn logs at warn level
+func (l *Logger) Warn(msg string, kv ...interface{}) { l.Log(LevelWarn, msg, kv...) }
+
+// Error logs at error level
+func (l *Logger) Error(msg string, kv ...interface{}) { l.Log(LevelError, msg, kv...) }
+
+// Fatal logs at error level and exits
+func (l *Logger) Fatal(msg string, kv ...interface{}) {
+	l.Log(LevelError, msg, kv...)
+	os.Exit(1)
+}
+
+// Log writes a line with the logger's fields and the key-value pairs
+func (l *Logger) Log(level Level, msg string, kv ...interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+
+	fields := map[string]interface{}{}
+	l.mu.RLock()
+	for k, v := range l.fields {
+		fields[k] = v
+	}
+	l.mu.RUnlock()
+	addFields(fields, kv)
+
+	fields["time"] = time.Now().UTC().Format(time.RFC3339Nano)
+	fields["level"] = level.String()
+	fields["msg"] = msg
+
+	var line []byte
+	if l.sink.format == FormatLogfmt {
+		line = encodeLogfmt(fields)
+	} else {
+		line = encodeJSON(fields)
+	}
+
+	l.sink.mu.Lock()
+	l.sink.out.Write(line)
+	l.sink.mu.Unlock()
+}
+
+func addFields(fields map[string]interface{}, kv []interface{}) {
+	for i := 0; i < len(kv); i += 2 {
+		key := fmt.Sprint(kv[i])
+		if i+1 == len(kv) {
+			fields[key] = "(missing)"
+			break
+		}
+
+		v := kv[i+1]
+		if err, ok := v.(error); ok {
+			v = err.Error()
+		}
+		fields[key] = v
+	}
+}
+
+func encodeJSON(fields map[string]interface{}) []byte {
+	b, err := json.Marshal(fields)
+	if err != nil {
+		b, _ = json.Marshal(map[string]interface{}{
+			"time":  fields["time"],
+			"level": fields["level"],
+			"msg":   fields["msg"],
+			"error": "failed to encode log fields: " + err.Error(),
+		})
+	}
+
+	return append(b, '\n')
+}
+
+// logfmt puts time, level and msg first and the other keys in order
+func encodeLogfmt(fields map[string]interface{}) []byte {
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		if k != "time" && k != "level" && k != "msg" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	keys = append([]string{"time", "level", "msg"}, keys...)
+
+	var buf bytes.Buffer
+	for i, k := range keys {
+		if i > 0 {
+			buf.WriteByte(' ')
+		}
+		buf.WriteString(k)
+		buf.WriteByte('=')
+		buf.WriteString(logfmtValue(fields[k]))
+	}
+	buf.WriteByte('\n')
+
+	return buf.Bytes()
+}
+
+func logfmtValue(v interface{}) string {
+	var s string
+	switch v := v.(type) {
+	case string:
+		s = v
+	case fmt.Stringer:
+		s = v.String()
+	case int, int64, float64, bool:
+		s = fmt.Sprint(v)
+	default:
+		b, err := json.Marshal(v)
+		if err != nil {
+			s = fmt.Sprint(v)
+		} else {
+			s = string(b)
+		}
+	}
+
+	if s == "" || strings.ContainsAny(s, " =\"\t\n") {
+		return strconv.Quote(s)
+	}
+
+	return s
+}
+
+type contextKey string
+
+const (
+	ctxKeyLogger    contextKey = "logger"
+	ctxKeyRequestID contextKey = "request_id"
+)
+
+// NewContext returns a context carrying l
+func NewContext(ctx context.Context, l *Logger) context.Context {
+	return context.WithValue(ctx, ctxKeyLogger, l)
+}
+
+// FromContext returns the logger on the context. Without one, lines are
+// discarded.
+func FromContext(ctx context.Context) *Logger {
+	if ctx != nil {
+		if l, ok := ctx.Value(ctxKeyLogger).(*Logger); ok {
+			return l
+		}
+	}
+
+	return discard
+}
+
+// WithRequestID returns a context carrying the ID of the request
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, ctxKeyRequestID, id)
+}
+
+// RequestID returns the ID of the request, if any
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(ctxKeyRequestID).(string)
+	return id
+}
+
+// AddFields attaches key-value pairs to the logger on the context, so they
+// appear on every line logged for the rest of the request
+func AddFields(ctx context.Context, kv ...interface{}) {
+	if l, ok := ctx.Value(ctxKeyLogger).(*Logger); ok {
+		l.Add(kv...)
+	}
+}
@@ -0,0 +1,133 @@
+package logging
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Redacted replaces the value of sensitive fields
+const Redacted = "[REDACTED]"
+
+// sensitiveNames are parts of field and key names whose values are masked
+var sensitiveNames = []string{
+	"password",
+	"secret",
+	"token",
+	"verifier",
+	"selector",
+	"recovery",
+	"csrf",
+}
+
+// sensitiveKeys are session and cookie keys whose values are masked
+var sensitiveKeys = map[string]bool{
+	"rm": true,
+}
+
+const maxRedactDepth = 8
+
+var (
+	jsonMarshaler = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshaler = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// IsSensitive reports whether values stored under name must not be logged
+func IsSensitive(name string) bool {
+	name = strings.ToLower(name)
+	if sensitiveKeys[name] {
+		return true
+	}
+
+	for _, s := range sensitiveNames {
+		if strings.Contains(name, s) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Redact returns a copy of v that is safe to log. Structs and maps become
+// maps, and fields tagged `log:"secret"` or with a sensitive name have their
+// value replaced by Redacted unless it is empty.
+func Redact(v interface{}) interface{} {
+	return redact(reflect.ValueOf(v), 0)
+}
+
+func redact(v reflect.Value, depth int) interface{} {
+	if !v.IsValid() {
+		return nil
+	}
+	if depth > maxRedactDepth {
+		return "..."
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return redact(v.Elem(), depth+1)
+
+	case reflect.Struct:
+		if v.Type().Implements(jsonMarshaler) || v.Type().Implements(textMarshaler) {
+			return v.Interface()
+		}
+
+		out := map[string]interface{}{}
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.PkgPath != "" {
+				continue
+			}
+
+			if f.Tag.Get("log") == "secret" || IsSensitive(f.Name) {
+				out[f.Name] = mask(v.Field(i))
+			} else {
+				out[f.Name] = redact(v.Field(i), depth+1)
+			}
+		}
+		return out
+
+	case reflect.Map:
+		out := map[string]interface{}{}
+		iter := v.MapRange()
+		for iter.Next() {
+			key := fmt.Sprint(iter.Key().Interface())
+			if IsSensitive(key) {
+				out[key] = mask(iter.Value())
+			} else {
+				out[key] = redact(iter.Value(), depth+1)
+			}
+		}
+		return out
+
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return nil
+		}
+		out := make([]interface{}, v.Len())
+		for i := range out {
+			out[i] = redact(v.Index(i), depth+1)
+		}
+		return out
+
+	case reflect.Func, reflect.Chan, reflect.UnsafePointer:
+		return v.Type().String()
+	}
+
+	return v.Interface()
+}
+
+// mask hides a value while still telling apart set and unset fields
+func mask(v reflect.Value) interface{} {
+	if !v.IsValid() || v.IsZero() {
+		return ""
+	}
+
+	return Redacted
+}
@@ -0,0 +1,131 @@
+package login
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi"
+	"github.com/volatiletech/authboss"
+
+	"github.com/nbycomp/login-consent/audit"
+	"github.com/nbycomp/login-consent/i18n"
+	"github.com/nbycomp/login-consent/model"
+	"github.com/nbycomp/login-consent/proxy"
+)
+
+// PageAccount lets users manage their own account
+const PageAccount = "account"
+
+// Account serves the self-service pages of logged in users, and records
+// their logins so they can review recent activity
+func Account(ab *authboss.Authboss) http.Handler {
+	ab.Events.After(authboss.EventAuth, func(w http.ResponseWriter, r *http.Request, handled bool) (bool, error) {
+		user, err := model.GetUser(ab, &r)
+		if err != nil {
+			return false, err
+		}
+
+		user.AddLogin(model.Login{
+			Time:      authenticationFor(r).Time,
+			IP:        proxy.ClientIP(r),
+			UserAgent: r.UserAgent(),
+			Methods:   authenticationFor(r).AMR,
+		})
+
+		return false, ab.Config.Storage.Server.Save(r.Context(), user)
+	})
+
+	mux := chi.NewRouter()
+	mux.Use(authboss.Middleware2(ab, authboss.RequireFullAuth, authboss.RespondRedirect))
+
+	mux.Get("/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		renderAccount(ab, w, r, http.StatusOK, nil)
+	}))
+
+	mux.Post("/name", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, err := model.GetUser(ab, &r)
+		if err != nil {
+			renderError(ab, w, r, http.StatusInternalServerError, "error_generic", err)
+			return
+		}
+
+		name := strings.TrimSpace(r.FormValue("name"))
+		if name == "" {
+			renderAccount(ab, w, r, http.StatusBadRequest, authboss.HTMLData{"name_error": i18n.T(r, "account_name_required")})
+			return
+		}
+
+		user.Name = name
+		if err := ab.Config.Storage.Server.Save(r.Context(), user); err != nil {
+			renderError(ab, w, r, http.StatusInternalServerError, "error_generic", err)
+			return
+		}
+
+		redirectToAccount(ab, w, r, "account_name_saved")
+	}))
+
+	mux.Post("/password", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, err := model.GetUser(ab, &r)
+		if err != nil {
+			renderError(ab, w, r, http.StatusInternalServerError, "error_generic", err)
+			return
+		}
+
+		var key string
+		password := r.FormValue("password")
+		switch {
+		case authboss.VerifyPassword(user, r.FormValue("current_password")) != nil:
+			key = "account_password_wrong"
+		case password == "":
+			key = "account_password_required"
+		case password != r.FormValue("confirm_password"):
+			key = "account_password_mismatch"
+		}
+		if key != "" {
+			renderAccount(ab, w, r, http.StatusBadRequest, authboss.HTMLData{"password_error": i18n.T(r, key)})
+			return
+		}
+
+		if err := ab.UpdatePassword(r.Context(), user, password); err != nil {
+			renderError(ab, w, r, http.StatusInternalServerError, "error_generic", err)
+			return
+		}
+
+		ab.RequestLogger(r).Infof("user %s changed their password", user.GetPID())
+		audit.Record(r, audit.Event{Type: audit.PasswordChanged, User: user.GetPID(), Subject: user.GetSubject()})
+		redirectToAccount(ab, w, r, "account_password_saved")
+	}))
+
+	return mux
+}
+
+func renderAccount(ab *authboss.Authboss, w http.ResponseWriter, r *http.Request, status int, data authboss.HTMLData) {
+	user, err := model.GetUser(ab, &r)
+	if err != nil {
+		renderError(ab, w, r, http.StatusInternalServerError, "error_generic", err)
+		return
+	}
+
+	if data == nil {
+		data = authboss.HTMLData{}
+	}
+	data.MergeKV(
+		"user", user,
+		"totp_enabled", user.GetTOTPSecretKey() != "",
+	)
+
+	if err := ab.Core.Responder.Respond(w, r, status, PageAccount, data); err != nil {
+		renderError(ab, w, r, http.StatusInternalServerError, "error_generic", err)
+	}
+}
+
+func redirectToAccount(ab *authboss.Authboss, w http.ResponseWriter, r *http.Request, key string) {
+	ro := authboss.RedirectOptions{
+		Code:         http.StatusFound,
+		RedirectPath: ab.Config.Paths.Mount + "/account",
+		Success:      i18n.T(r, key),
+	}
+	if err := ab.Core.Redirector.Redirect(w, r, ro); err != nil {
+		renderError(ab, w, r, http.StatusInternalServerError, "error_generic", err)
+	}
+}
@@ -0,0 +1,95 @@
+package login
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/volatiletech/authboss"
+)
+
+// Authentication method references, see RFC 8176
+const (
+	AMRPassword  = "pwd"
+	AMROTP       = "otp"
+	AMRSMS       = "sms"
+	AMRFederated = "fed"
+	AMRMulti     = "mfa"
+)
+
+// Authentication context class references reported to Hydra
+const (
+	ACRSingleFactor = "pwd"
+	ACRMultiFactor  = "mfa"
+)
+
+// authentication describes how and when the user proved their identity
+type authentication struct {
+	Time time.Time
+	AMR  []string
+}
+
+// authenticationFor works out the methods used from the route on which
+// authboss fired EventAuth or EventOAuth2.
+func authenticationFor(r *http.Request) authentication {
+	var amr []string
+	switch {
+	case strings.HasSuffix(r.URL.Path, "/2fa/totp/validate"):
+		amr = []string{AMRPassword, AMROTP, AMRMulti}
+	case strings.HasSuffix(r.URL.Path, "/2fa/sms/validate"):
+		amr = []string{AMRPassword, AMRSMS, AMRMulti}
+	case strings.Contains(r.URL.Path, "/oauth2/"):
+		amr = []string{AMRFederated}
+	default:
+		amr = []string{AMRPassword}
+	}
+
+	return authentication{Time: time.Now(), AMR: amr}
+}
+
+// ACR is the authentication context class satisfied by the methods used
+func (a authentication) ACR() string {
+	for _, m := range a.AMR {
+		if m == AMRMulti {
+			return ACRMultiFactor
+		}
+	}
+
+	return ACRSingleFactor
+}
+
+// Context is the login metadata handed to Hydra, which passes it on to
+// the consent request.
+func (a authentication) Context() map[string]interface{} {
+	return map[string]interface{}{
+		"auth_time": a.Time.Unix(),
+		"acr":       a.ACR(),
+		"amr":       a.AMR,
+	}
+}
+
+// put remembers the authentication in the authboss session
+func (a authentication) put(w http.ResponseWriter) {
+	authboss.PutSession(w, SessionAuthTime, strconv.FormatInt(a.Time.Unix(), 10))
+	authboss.PutSession(w, SessionAMR, strings.Join(a.AMR, " "))
+}
+
+// sessionAuthentication reads back the authentication stored by put. Time is
+// zero if the session predates it.
+func sessionAuthentication(r *http.Request) authentication {
+	var a authentication
+	if v, ok := authboss.GetSession(r, SessionAuthTime); ok {
+		if secs, err := strconv.ParseInt(v, 10, 64); err == nil {
+			a.Time = time.Unix(secs, 0)
+		}
+	}
+
+	if v, ok := authboss.GetSession(r, SessionAMR); ok {
+		a.AMR = strings.Fields(v)
+	} else {
+		a.AMR = []string{AMRPassword}
+	}
+
+	return a
+}
@@ -0,0 +1,92 @@
+package login
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/volatiletech/authboss"
+
+	"github.com/nbycomp/login-consent/audit"
+	"github.com/nbycomp/login-consent/i18n"
+	"github.com/nbycomp/login-consent/model"
+)
+
+// PageApps lists the applications the user has granted access to
+const PageApps = "apps"
+
+// ConsentSession is a consent previously granted by a user to a client
+type ConsentSession struct {
+	ConsentRequest struct {
+		Client Client `json:"client"`
+	} `json:"consent_request"`
+	GrantScope []string  `json:"grant_scope"`
+	HandledAt  time.Time `json:"handled_at"`
+}
+
+func (h *Hydra) getConsentSessions(subject string) ([]ConsentSession, error) {
+	var res []ConsentSession
+	url := h.makeSessionsURL(consent, subject, "")
+	err := h.getJSON(url, &res)
+
+	return res, err
+}
+
+// Apps lets logged in users see and revoke the consent they have given to
+// OAuth2 clients
+func Apps(ab *authboss.Authboss, h *Hydra) http.Handler {
+	mux := chi.NewRouter()
+	mux.Use(authboss.Middleware2(ab, authboss.RequireFullAuth, authboss.RespondRedirect))
+
+	mux.Get("/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, err := model.GetUser(ab, &r)
+		if err != nil {
+			renderError(ab, w, r, http.StatusInternalServerError, "error_generic", err)
+			return
+		}
+
+		sessions, err := h.getConsentSessions(user.GetSubject())
+		if err != nil {
+			renderError(ab, w, r, http.StatusBadGateway, "error_hydra", err)
+			return
+		}
+
+		data := authboss.HTMLData{"sessions": sessions}
+		if err := ab.Core.Responder.Respond(w, r, http.StatusOK, PageApps, data); err != nil {
+			renderError(ab, w, r, http.StatusInternalServerError, "error_generic", err)
+		}
+	}))
+
+	mux.Post("/revoke", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, err := model.GetUser(ab, &r)
+		if err != nil {
+			renderError(ab, w, r, http.StatusInternalServerError, "error_generic", err)
+			return
+		}
+
+		clientID := r.FormValue("client_id")
+		if err := h.revokeConsentSessions(user.GetSubject(), clientID); err != nil {
+			renderError(ab, w, r, http.StatusBadGateway, "error_hydra", err)
+			return
+		}
+
+		ab.RequestLogger(r).Infof("user %s revoked consent for client %q", user.GetPID(), clientID)
+		audit.Record(r, audit.Event{
+			Type:     audit.ConsentRevoked,
+			User:     user.GetPID(),
+			Subject:  user.GetSubject(),
+			ClientID: clientID,
+		})
+
+		ro := authboss.RedirectOptions{
+			Code:         http.StatusFound,
+			RedirectPath: ab.Config.Paths.Mount + "/apps",
+			Success:      i18n.T(r, "apps_revoked"),
+		}
+		if err := ab.Core.Redirector.Redirect(w, r, ro); err != nil {
+			renderError(ab, w, r, http.StatusInternalServerError, "error_generic", err)
+		}
+	}))
+
+	return mux
+}
@@ -0,0 +1,116 @@
+package login
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/volatiletech/authboss"
+
+	"github.com/nbycomp/login-consent/audit"
+	"github.com/nbycomp/login-consent/model"
+)
+
+// Audit records the authentication events fired by authboss
+func Audit(ab *authboss.Authboss) {
+	ab.Events.After(authboss.EventAuth, func(w http.ResponseWriter, r *http.Request, handled bool) (bool, error) {
+		audit.Record(r, auditEvent(r, audit.LoginSucceeded, authenticationFor(r).AMR))
+		return false, nil
+	})
+
+	ab.Events.After(authboss.EventOAuth2, func(w http.ResponseWriter, r *http.Request, handled bool) (bool, error) {
+		audit.Record(r, auditEvent(r, audit.LoginSucceeded, []string{AMRFederated}))
+		return false, nil
+	})
+
+	ab.Events.After(authboss.EventOAuth2Fail, func(w http.ResponseWriter, r *http.Request, handled bool) (bool, error) {
+		audit.Record(r, auditEvent(r, audit.LoginFailed, []string{AMRFederated}))
+		return false, nil
+	})
+
+	ab.Events.After(authboss.EventAuthFail, func(w http.ResponseWriter, r *http.Request, handled bool) (bool, error) {
+		audit.Record(r, auditEvent(r, audit.LoginFailed, authenticationFor(r).AMR))
+
+		if user, ok := r.Context().Value(authboss.CTXKeyUser).(*model.User); ok && handled && user.GetLocked().After(time.Now()) {
+			audit.Record(r, auditEvent(r, audit.AccountLocked, nil))
+		}
+
+		return false, nil
+	})
+}
+
+// auditEvent describes the user authboss is authenticating, and the Hydra
+// login request if there is one
+func auditEvent(r *http.Request, typ string, methods []string) audit.Event {
+	e := audit.Event{Type: typ, Methods: methods}
+
+	if user, ok := r.Context().Value(authboss.CTXKeyUser).(*model.User); ok {
+		e.User = user.GetPID()
+		e.Subject = user.GetSubject()
+	}
+
+	if ch, ok := r.Context().Value(CTXKeyChallenge).(string); ok {
+		e.Challenge = ch
+	} else {
+		e.Challenge, _ = authboss.GetSession(r, SessionChallenge)
+	}
+	if req, ok := GetLoginRequest(r); ok {
+		e.ClientID = req.Client.ClientID
+		e.Scopes = req.RequestedScope
+	}
+
+	return e
+}
+
+// AuditMiddleware records changes to the second factors of the user made
+// through the authboss two-factor routes, which fire no events.
+func AuditMiddleware(ab *authboss.Authboss) Middleware {
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				handler.ServeHTTP(w, r)
+				return
+			}
+
+			switch r.URL.Path {
+			case "/2fa/totp/confirm", "/2fa/totp/remove", "/2fa/recovery/regen":
+			default:
+				handler.ServeHTTP(w, r)
+				return
+			}
+
+			pid, ok := authboss.GetSession(r, authboss.SessionKey)
+			if !ok {
+				handler.ServeHTTP(w, r)
+				return
+			}
+
+			before, err := ab.Config.Storage.Server.Load(r.Context(), pid)
+			if err != nil {
+				handler.ServeHTTP(w, r)
+				return
+			}
+
+			handler.ServeHTTP(w, r)
+
+			after, err := ab.Config.Storage.Server.Load(r.Context(), pid)
+			if err != nil {
+				return
+			}
+
+			old, user := before.(*model.User), after.(*model.User)
+			e := audit.Event{User: pid, Subject: user.GetSubject()}
+			switch {
+			case old.TOTPSecretKey == "" && user.TOTPSecretKey != "":
+				e.Type = audit.TOTPEnabled
+			case old.TOTPSecretKey != "" && user.TOTPSecretKey == "":
+				e.Type = audit.TOTPRemoved
+			case old.RecoveryCodes != user.RecoveryCodes && r.URL.Path == "/2fa/recovery/regen":
+				e.Type = audit.RecoveryCodes
+			default:
+				return
+			}
+
+			audit.Record(r, e)
+		})
+	}
+}
@@ -2,12 +2,19 @@ package login
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"net/url"
-	"os"
 	"time"
+
+	"github.com/nbycomp/login-consent/config"
+	"github.com/nbycomp/login-consent/logging"
+	"github.com/nbycomp/login-consent/metrics"
+	"github.com/nbycomp/login-consent/tlsutil"
 )
 
 type flow string
@@ -18,37 +25,95 @@ const (
 	logout  flow = "logout"
 )
 
-var baseURL *url.URL
-var client *http.Client
+// rejectRequest is the body used to reject a login, consent or logout request
+type rejectRequest struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+	StatusCode       int    `json:"status_code,omitempty"`
+}
+
+// redirectResponse is Hydra's answer to a reject request
+type redirectResponse struct {
+	RedirectTo string `json:"redirect_to"`
+}
+
+var errUserDisabled = errors.New("user is disabled")
+
+// Hydra is a client of the Hydra admin API
+type Hydra struct {
+	baseURL *url.URL
+	client  *http.Client
+
+	// pairwiseSalt is mixed into pairwise subject identifiers. Pairwise
+	// subjects are only derived here when it is set; otherwise Hydra's own
+	// pairwise support applies.
+	pairwiseSalt string
 
-func init() {
-	u, err := url.Parse(os.Getenv("HYDRA_ADMIN_URL"))
+	metrics *metrics.Metrics
+}
+
+// NewHydra creates a client of the admin API at cfg.HydraAdminURL. Reloads
+// of the client certificate are logged to log, and the calls and the flows
+// built on the client are counted in m.
+func NewHydra(cfg config.Config, log *logging.Logger, m *metrics.Metrics) (*Hydra, error) {
+	u, err := url.Parse(cfg.HydraAdminURL)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
-	baseURL = u
-
-	client = &http.Client{
-		Timeout: 10 * time.Second,
+	tlsConfig, err := tlsutil.ClientConfig(cfg.HydraCAFile, cfg.HydraClientCertFile, cfg.HydraClientKeyFile, log)
+	if err != nil {
+		return nil, err
 	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+
+	return &Hydra{
+		baseURL: u,
+		client: &http.Client{
+			Timeout:   10 * time.Second,
+			Transport: metricsTransport{next: transport, metrics: m},
+		},
+		pairwiseSalt: cfg.PairwiseSalt,
+		metrics:      m,
+	}, nil
 }
 
-func makeGetURL(f flow, challenge string) string {
-	return makeURL("/oauth2/auth/requests/"+string(f), f, challenge)
+func (h *Hydra) makeGetURL(f flow, challenge string) string {
+	return h.makeURL("/oauth2/auth/requests/"+string(f), f, challenge)
 }
 
-func makeAcceptURL(f flow, challenge string) string {
-	return makeURL("/oauth2/auth/requests/"+string(f)+"/accept", f, challenge)
+func (h *Hydra) makeAcceptURL(f flow, challenge string) string {
+	return h.makeURL("/oauth2/auth/requests/"+string(f)+"/accept", f, challenge)
 }
 
-func makeURL(path string, f flow, challenge string) string {
+func (h *Hydra) makeRejectURL(f flow, challenge string) string {
+	return h.makeURL("/oauth2/auth/requests/"+string(f)+"/reject", f, challenge)
+}
+
+// makeSessionsURL returns the admin URL for the login or consent sessions
+// of a subject, optionally restricted to a single client
+func (h *Hydra) makeSessionsURL(f flow, subject, clientID string) string {
+	u := h.baseURL.ResolveReference(&url.URL{Path: "/oauth2/auth/sessions/" + string(f)})
+
+	q := u.Query()
+	q.Set("subject", subject)
+	if clientID != "" {
+		q.Set("client", clientID)
+	}
+	u.RawQuery = q.Encode()
+
+	return u.String()
+}
+
+func (h *Hydra) makeURL(path string, f flow, challenge string) string {
 	p, err := url.Parse(path)
 	if err != nil {
 		panic(err)
 	}
 
-	u := baseURL.ResolveReference(p)
+	u := h.baseURL.ResolveReference(p)
 
 	q := u.Query()
 	q.Set(string(f)+"_challenge", challenge)
@@ -57,30 +122,73 @@ func makeURL(path string, f flow, challenge string) string {
 	return u.String()
 }
 
-func getJSON(url string, target interface{}) error {
-	res, err := client.Get(url)
+// Ping checks that the Hydra admin API is reachable and ready
+func (h *Hydra) Ping(ctx context.Context) error {
+	u := h.baseURL.ResolveReference(&url.URL{Path: "/health/ready"})
+	req, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
+	}
+
+	res, err := h.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	return decodeResponse(res, nil)
+}
+
+func (h *Hydra) getJSON(url string, target interface{}) error {
+	res, err := h.client.Get(url)
 	if err != nil {
 		return err
 	}
 	defer res.Body.Close()
 
-	return json.NewDecoder(res.Body).Decode(target)
+	return decodeResponse(res, target)
 }
 
-func putJSON(url string, body interface{}, target interface{}) error {
+func (h *Hydra) putJSON(url string, body interface{}, target interface{}) error {
 	var b io.Reader
 	if body != nil {
 		jsonBody, _ := json.Marshal(body)
 		b = bytes.NewBuffer(jsonBody)
 	}
 	req, _ := http.NewRequest(http.MethodPut, url, b)
+	req.Header.Set("Content-Type", "application/json")
 
-	res, err := client.Do(req)
+	res, err := h.client.Do(req)
 	if err != nil {
-		panic(err)
+		return err
+	}
+
+	defer res.Body.Close()
+
+	return decodeResponse(res, target)
+}
+
+func (h *Hydra) deleteRequest(url string) error {
+	req, _ := http.NewRequest(http.MethodDelete, url, nil)
+
+	res, err := h.client.Do(req)
+	if err != nil {
+		return err
 	}
 
 	defer res.Body.Close()
 
+	return decodeResponse(res, nil)
+}
+
+func decodeResponse(res *http.Response, target interface{}) error {
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("hydra responded to %s %s with status %d", res.Request.Method, res.Request.URL.Path, res.StatusCode)
+	}
+
+	if target == nil || res.StatusCode == http.StatusNoContent {
+		return nil
+	}
+
 	return json.NewDecoder(res.Body).Decode(target)
 }
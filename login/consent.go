@@ -4,79 +4,155 @@ import (
 	"net/http"
 
 	"github.com/go-chi/chi"
-	"github.com/nbycomp/login-consent/model"
 	"github.com/volatiletech/authboss"
+
+	"github.com/nbycomp/login-consent/audit"
+	"github.com/nbycomp/login-consent/logging"
 )
 
 type getConsentResponse struct {
-	Skip                         bool     `json:"skip"`
-	RequestedScope               []string `json:"requested_scope"`
-	RequestedAccessTokenAudience []string `json:"requested_access_token_audience"`
+	Subject                      string       `json:"subject"`
+	Client                       Client       `json:"client"`
+	Skip                         bool         `json:"skip"`
+	RequestedScope               []string     `json:"requested_scope"`
+	RequestedAccessTokenAudience []string     `json:"requested_access_token_audience"`
+	Context                      loginContext `json:"context"`
+}
+
+// loginContext is the context sent along when accepting the login request
+type loginContext struct {
+	AuthTime int64    `json:"auth_time"`
+	ACR      string   `json:"acr"`
+	AMR      []string `json:"amr"`
 }
 
-func getConsentRequest(challenge string) getConsentResponse {
+func (h *Hydra) getConsentRequest(challenge string) (getConsentResponse, error) {
 	var res getConsentResponse
-	url := makeGetURL(consent, challenge)
-	getJSON(url, &res)
+	url := h.makeGetURL(consent, challenge)
+	err := h.getJSON(url, &res)
 
-	return res
+	return res, err
 }
 
 type acceptConsentResponse struct {
 	RedirectTo string `json:"redirect_to"`
 }
 
-func acceptConsentRequest(challenge string, body map[string]interface{}) acceptConsentResponse {
+func (h *Hydra) acceptConsentRequest(challenge string, body map[string]interface{}) (acceptConsentResponse, error) {
 	var res acceptConsentResponse
-	url := makeAcceptURL(consent, challenge)
-	putJSON(url, body, &res)
+	url := h.makeAcceptURL(consent, challenge)
+	err := h.putJSON(url, body, &res)
+
+	return res, err
+}
+
+func (h *Hydra) rejectConsentRequest(challenge string, body rejectRequest) (redirectResponse, error) {
+	var res redirectResponse
+	url := h.makeRejectURL(consent, challenge)
+	err := h.putJSON(url, body, &res)
 
-	return res
+	return res, err
 }
 
 type AccessToken struct {
-	Role string `json:"role"`
+	Role string   `json:"role"`
+	ACR  string   `json:"acr,omitempty"`
+	AMR  []string `json:"amr,omitempty"`
 }
 
 type IDToken struct {
-	Name  string `json:"name"`
-	Email string `json:"email"`
-	Role  string `json:"role"`
+	Name  string   `json:"name"`
+	Email string   `json:"email"`
+	Role  string   `json:"role"`
+	AMR   []string `json:"amr,omitempty"`
 }
 
-func Consent(ab *authboss.Authboss) http.Handler {
+func Consent(ab *authboss.Authboss, h *Hydra) http.Handler {
 	mux := chi.NewRouter()
 
 	mux.Get("/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if ch := r.URL.Query().Get("consent_challenge"); ch != "" {
-			getRes := getConsentRequest(ch)
-
-			var accessToken AccessToken
-			var idToken IDToken
-			if user, err := model.GetUser(ab, &r); err == nil {
-				accessToken = AccessToken{
-					Role: user.Role,
-				}
-				idToken = IDToken{
-					Name:  user.Name,
-					Email: user.Email,
-					Role:  user.Role,
-				}
-			}
+		ch := r.URL.Query().Get("consent_challenge")
+		if ch == "" {
+			renderError(ab, w, r, http.StatusBadRequest, "error_no_challenge", nil)
+			return
+		}
+		logging.AddFields(r.Context(), "consent_challenge", ch)
 
-			body := map[string]interface{}{
-				"grant_scope":                 getRes.RequestedScope,
-				"grant_access_token_audience": getRes.RequestedAccessTokenAudience,
-				"session": map[string]interface{}{
-					"access_token": accessToken,
-					"id_token":     idToken,
-				},
+		getRes, err := h.getConsentRequest(ch)
+		if err != nil {
+			renderError(ab, w, r, http.StatusBadGateway, "error_hydra", err)
+			return
+		}
+
+		user, err := loadBySubject(ab, r.Context(), getRes.Subject)
+		if err == nil && user.IsDisabled() {
+			err = errUserDisabled
+		}
+		if err != nil {
+			ab.RequestLogger(r).Infof("rejecting consent for subject %s: %v", getRes.Subject, err)
+			reason := err.Error()
+
+			rejRes, err := h.rejectConsentRequest(ch, rejectRequest{
+				Error:            "access_denied",
+				ErrorDescription: "The user no longer has access",
+				StatusCode:       http.StatusForbidden,
+			})
+			if err != nil {
+				renderError(ab, w, r, http.StatusBadGateway, "consent_failed", err)
+				return
 			}
+			h.metrics.ConsentDecisions.WithLabelValues("rejected").Inc()
+			audit.Record(r, audit.Event{
+				Type:      audit.ConsentRejected,
+				Subject:   getRes.Subject,
+				ClientID:  getRes.Client.ClientID,
+				Scopes:    getRes.RequestedScope,
+				Challenge: ch,
+				Reason:    reason,
+			})
+
+			http.Redirect(w, r, rejRes.RedirectTo, http.StatusFound)
+			return
+		}
 
-			accRes := acceptConsentRequest(ch, body)
+		accessToken := AccessToken{
+			Role: user.Role,
+			ACR:  getRes.Context.ACR,
+			AMR:  getRes.Context.AMR,
+		}
+		idToken := IDToken{
+			Name:  user.Name,
+			Email: user.Email,
+			Role:  user.Role,
+			AMR:   getRes.Context.AMR,
+		}
+
+		body := map[string]interface{}{
+			"grant_scope":                 getRes.RequestedScope,
+			"grant_access_token_audience": getRes.RequestedAccessTokenAudience,
+			"session": map[string]interface{}{
+				"access_token": accessToken,
+				"id_token":     idToken,
+			},
+		}
 
-			http.Redirect(w, r, accRes.RedirectTo, http.StatusFound)
+		accRes, err := h.acceptConsentRequest(ch, body)
+		if err != nil {
+			renderError(ab, w, r, http.StatusBadGateway, "consent_failed", err)
+			return
 		}
+		h.metrics.ConsentDecisions.WithLabelValues("accepted").Inc()
+		audit.Record(r, audit.Event{
+			Type:      audit.ConsentAccepted,
+			User:      user.GetPID(),
+			Subject:   getRes.Subject,
+			Methods:   getRes.Context.AMR,
+			ClientID:  getRes.Client.ClientID,
+			Scopes:    getRes.RequestedScope,
+			Challenge: ch,
+		})
+
+		http.Redirect(w, r, accRes.RedirectTo, http.StatusFound)
 	}))
 
 	return mux
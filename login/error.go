@@ -0,0 +1,24 @@
+package login
+
+import (
+	"net/http"
+
+	"github.com/nbycomp/login-consent/i18n"
+	"github.com/volatiletech/authboss"
+)
+
+// PageError is the page rendered when a flow cannot be completed
+const PageError = "error"
+
+// renderError shows the error page with the message for key in the
+// locale of the request, logging err if there is one.
+func renderError(ab *authboss.Authboss, w http.ResponseWriter, r *http.Request, status int, key string, err error) {
+	if err != nil {
+		ab.RequestLogger(r).Errorf("%s %s: %v", r.Method, r.URL.Path, err)
+	}
+
+	data := authboss.HTMLData{"message": i18n.T(r, key)}
+	if err := ab.Core.Responder.Respond(w, r, status, PageError, data); err != nil {
+		http.Error(w, http.StatusText(status), status)
+	}
+}
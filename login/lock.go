@@ -0,0 +1,39 @@
+package login
+
+import (
+	"net/http"
+
+	"github.com/volatiletech/authboss"
+	"github.com/volatiletech/authboss/lock"
+
+	"github.com/nbycomp/login-consent/i18n"
+)
+
+// lockRedirector shows the login page again when the lock module turns an
+// attempt away. The module redirects with 307, which would have the browser
+// post the form again, and its message is not translated.
+type lockRedirector struct {
+	authboss.HTTPRedirector
+	ab *authboss.Authboss
+}
+
+// LockRedirector wraps the redirector of ab, which must be set, so that
+// attempts on a locked account answer 403 with the login page, which keeps
+// the Hydra challenge of the flow
+func LockRedirector(ab *authboss.Authboss) authboss.HTTPRedirector {
+	return lockRedirector{HTTPRedirector: ab.Config.Core.Redirector, ab: ab}
+}
+
+func (l lockRedirector) Redirect(w http.ResponseWriter, r *http.Request, ro authboss.RedirectOptions) error {
+	user, ok := r.Context().Value(authboss.CTXKeyUser).(authboss.LockableUser)
+	if !ok || !lock.IsLocked(user) || ro.RedirectPath != l.ab.Config.Paths.LockNotOK || r.Method != http.MethodPost {
+		return l.HTTPRedirector.Redirect(w, r, ro)
+	}
+
+	l.ab.RequestLogger(r).Infof("user %s is locked", user.GetPID())
+	data := authboss.HTMLData{
+		authboss.DataErr: i18n.T(r, "login_locked"),
+		"primaryIDValue": r.FormValue("email"),
+	}
+	return l.ab.Core.Responder.Respond(w, r, http.StatusForbidden, "login", data)
+}
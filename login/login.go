@@ -3,92 +3,191 @@ package login
 import (
 	"context"
 	"net/http"
+	"time"
 
 	"github.com/volatiletech/authboss"
 
+	"github.com/nbycomp/login-consent/audit"
+	"github.com/nbycomp/login-consent/i18n"
+	"github.com/nbycomp/login-consent/logging"
 	"github.com/nbycomp/login-consent/model"
 )
 
 type contextKey string
 
 const (
-	CTXKeyChallenge contextKey = "challenge"
+	CTXKeyChallenge    contextKey = "challenge"
+	CTXKeyLoginRequest contextKey = "login_request"
+
+	// SessionAuthTime holds the unix time at which the user last entered
+	// their credentials
+	SessionAuthTime = "auth_time"
+	// SessionAMR holds the space separated authentication methods used
+	SessionAMR = "amr"
+	// SessionChallenge keeps the login challenge across the redirects of
+	// two-factor and OAuth2 logins
+	SessionChallenge = "login_challenge"
 )
 
-type getLoginResponse struct {
-	Skip    bool   `json:"skip"`
-	Subject string `json:"subject"`
+// StepUpACRValues are the acr_values for which a second factor is required
+var StepUpACRValues = []string{
+	"mfa",
+	"http://schemas.openid.net/pape/policies/2007/06/multi-factor",
 }
 
-func getLoginRequest(challenge string) getLoginResponse {
-	var res getLoginResponse
-	url := makeGetURL(login, challenge)
-	getJSON(url, &res)
+func (h *Hydra) getLoginRequest(challenge string) (LoginRequest, error) {
+	var res LoginRequest
+	url := h.makeGetURL(login, challenge)
+	err := h.getJSON(url, &res)
 
-	return res
+	return res, err
 }
 
 type acceptLoginResponse struct {
 	RedirectTo string `json:"redirect_to"`
 }
 
-func acceptLoginRequest(challenge string, body map[string]interface{}) acceptLoginResponse {
+func (h *Hydra) acceptLoginRequest(challenge string, body map[string]interface{}) (acceptLoginResponse, error) {
 	var res acceptLoginResponse
-	url := makeAcceptURL(login, challenge)
-	putJSON(url, body, &res)
+	url := h.makeAcceptURL(login, challenge)
+	err := h.putJSON(url, body, &res)
 
-	return res
+	return res, err
+}
+
+func (h *Hydra) rejectLoginRequest(challenge string, body rejectRequest) (redirectResponse, error) {
+	var res redirectResponse
+	url := h.makeRejectURL(login, challenge)
+	err := h.putJSON(url, body, &res)
+
+	return res, err
 }
 
 type Middleware func(http.Handler) http.Handler
 
-func LoginMiddleware(ab *authboss.Authboss) Middleware {
+func LoginMiddleware(ab *authboss.Authboss, h *Hydra) Middleware {
 	return func(handler http.Handler) http.Handler {
-		ab.Events.After(authboss.EventAuth, func(w http.ResponseWriter, r *http.Request, handled bool) (bool, error) {
+		ab.Events.Before(authboss.EventAuth, func(w http.ResponseWriter, r *http.Request, handled bool) (bool, error) {
+			if handled {
+				return true, nil
+			}
+
+			if user, ok := r.Context().Value(authboss.CTXKeyUser).(*model.User); ok && user.IsDisabled() {
+				ab.RequestLogger(r).Infof("disabled user %s tried to log in", user.GetPID())
+				h.metrics.AuthAttempts.WithLabelValues("disabled", authMethod(r)).Inc()
+				e := auditEvent(r, audit.LoginRejected, authenticationFor(r).AMR)
+				e.Reason = errUserDisabled.Error()
+				audit.Record(r, e)
+				data := authboss.HTMLData{authboss.DataErr: i18n.T(r, "login_disabled")}
+				return true, ab.Core.Responder.Respond(w, r, http.StatusForbidden, "login", data)
+			}
+
+			return false, nil
+		})
+
+		ab.Events.Before(authboss.EventAuth, func(w http.ResponseWriter, r *http.Request, handled bool) (bool, error) {
+			if handled {
+				return true, nil
+			}
+
+			req, ok := GetLoginRequest(r)
+			if !ok || !req.WantsACR(StepUpACRValues...) {
+				return false, nil
+			}
+
+			if user, ok := r.Context().Value(authboss.CTXKeyUser).(*model.User); ok && hasSecondFactor(user) {
+				return false, nil
+			}
+
+			renderError(ab, w, r, http.StatusForbidden, "login_mfa_required", nil)
+			return true, nil
+		})
+
+		afterAuth := func(w http.ResponseWriter, r *http.Request, handled bool) (bool, error) {
+			ch, ok := r.Context().Value(CTXKeyChallenge).(string)
+			if !ok {
+				ch, _ = authboss.GetSession(r, SessionChallenge)
+			}
+			if ch == "" {
+				return false, nil
+			}
+			authboss.DelSession(w, SessionChallenge)
+			logging.AddFields(r.Context(), "login_challenge", ch)
+
 			user, err := model.GetUser(ab, &r)
 			if err != nil {
 				return false, err
 			}
 
-			body := map[string]interface{}{
-				"subject":      user.GetEmail(),
-				"remember":     true,
-				"remember_for": 3600,
+			req, ok := GetLoginRequest(r)
+			if !ok {
+				if req, err = h.getLoginRequest(ch); err != nil {
+					renderError(ab, w, r, http.StatusBadGateway, "error_hydra", err)
+					return true, nil
+				}
 			}
 
-			ch := r.Context().Value(CTXKeyChallenge).(string)
-			res := acceptLoginRequest(ch, body)
+			auth := authenticationFor(r)
+			auth.put(w)
+
+			if req.WantsACR(StepUpACRValues...) && auth.ACR() != ACRMultiFactor {
+				e := loginAuditEvent(audit.LoginRejected, ch, req, "second factor required")
+				e.User, e.Subject, e.Methods = user.GetPID(), user.GetSubject(), auth.AMR
+				audit.Record(r, e)
+
+				renderError(ab, w, r, http.StatusForbidden, "login_mfa_required", nil)
+				return true, nil
+			}
 
-			http.Redirect(w, r, res.RedirectTo, http.StatusFound)
+			acceptLogin(ab, h, w, r, ch, req, user, auth)
 
 			return true, nil
-		})
+		}
+		ab.Events.After(authboss.EventAuth, afterAuth)
+		ab.Events.After(authboss.EventOAuth2, afterAuth)
 
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			if r.URL.Path == "/login" {
+				var ch string
 				switch r.Method {
 				case http.MethodGet:
-					if ch := r.URL.Query().Get("login_challenge"); ch != "" {
-						res := getLoginRequest(ch)
-
-						if res.Skip {
-							body := map[string]interface{}{
-								"subject": res.Subject,
-							}
-							res := acceptLoginRequest(ch, body)
-							http.Redirect(w, r, res.RedirectTo, http.StatusFound)
+					ch = r.URL.Query().Get("login_challenge")
+				case http.MethodPost:
+					ch = r.FormValue("challenge")
+				}
+
+				if ch != "" {
+					logging.AddFields(r.Context(), "login_challenge", ch)
+
+					req, err := h.getLoginRequest(ch)
+					if err != nil {
+						renderError(ab, w, r, http.StatusBadGateway, "error_hydra", err)
+						return
+					}
+
+					if r.Method == http.MethodGet {
+						if req.Skip {
+							skipLogin(ab, h, w, r, ch, req)
 							return
 						}
 
-						r = r.WithContext(context.WithValue(r.Context(), CTXKeyChallenge, ch))
-
-						if d, ok := r.Context().Value(authboss.CTXKeyData).(authboss.HTMLData); ok {
-							r = r.WithContext(context.WithValue(r.Context(), authboss.CTXKeyData, d.MergeKV("challenge", ch)))
+						if req.ForceLogin() {
+							authboss.DelKnownSession(w)
+							authboss.DelKnownCookie(w)
+						} else if user, auth, ok := sessionUser(ab, r, req); ok {
+							acceptLogin(ab, h, w, r, ch, req, user, auth)
+							return
 						}
 
+						authboss.PutSession(w, SessionChallenge, ch)
 					}
-				case http.MethodPost:
-					r = r.WithContext(context.WithValue(r.Context(), CTXKeyChallenge, r.FormValue("challenge")))
+
+					r = withLoginRequest(r, ch, req)
+				} else {
+					// A login outside of a Hydra flow must not complete a
+					// challenge left behind in the session
+					authboss.DelSession(w, SessionChallenge)
+					r = r.WithContext(context.WithValue(r.Context(), CTXKeyChallenge, ""))
 				}
 			}
 
@@ -96,3 +195,140 @@ func LoginMiddleware(ab *authboss.Authboss) Middleware {
 		})
 	}
 }
+
+// skipLogin accepts a login request Hydra remembers the subject of, unless
+// that user has since been removed or disabled.
+func skipLogin(ab *authboss.Authboss, h *Hydra, w http.ResponseWriter, r *http.Request, ch string, req LoginRequest) {
+	user, err := loadBySubject(ab, r.Context(), req.Subject)
+	if err == nil && user.IsDisabled() {
+		err = errUserDisabled
+	}
+	if err != nil {
+		ab.RequestLogger(r).Infof("rejecting login for subject %s: %v", req.Subject, err)
+		reason := err.Error()
+
+		res, err := h.rejectLoginRequest(ch, rejectRequest{
+			Error:            "access_denied",
+			ErrorDescription: "The user no longer has access",
+			StatusCode:       http.StatusForbidden,
+		})
+		if err != nil {
+			renderError(ab, w, r, http.StatusBadGateway, "error_hydra", err)
+			return
+		}
+		audit.Record(r, loginAuditEvent(audit.LoginRejected, ch, req, reason))
+
+		http.Redirect(w, r, res.RedirectTo, http.StatusFound)
+		return
+	}
+
+	body := map[string]interface{}{
+		"subject": req.Subject,
+	}
+	res, err := h.acceptLoginRequest(ch, body)
+	if err != nil {
+		renderError(ab, w, r, http.StatusBadGateway, "error_hydra", err)
+		return
+	}
+
+	e := loginAuditEvent(audit.LoginAccepted, ch, req, "remembered by hydra")
+	e.User = user.GetPID()
+	audit.Record(r, e)
+
+	http.Redirect(w, r, res.RedirectTo, http.StatusFound)
+}
+
+// acceptLogin accepts the login challenge for user and redirects back to Hydra
+func acceptLogin(ab *authboss.Authboss, h *Hydra, w http.ResponseWriter, r *http.Request, ch string, req LoginRequest, user *model.User, auth authentication) {
+	body := map[string]interface{}{
+		"subject":      user.GetSubject(),
+		"remember":     true,
+		"remember_for": 3600,
+		"acr":          auth.ACR(),
+		"amr":          auth.AMR,
+		"context":      auth.Context(),
+	}
+	if sub, ok := h.pairwiseSubject(req.Client, user.GetSubject()); ok {
+		body["force_subject_identifier"] = sub
+	}
+
+	res, err := h.acceptLoginRequest(ch, body)
+	if err != nil {
+		renderError(ab, w, r, http.StatusBadGateway, "error_hydra", err)
+		return
+	}
+
+	e := loginAuditEvent(audit.LoginAccepted, ch, req, "")
+	e.User, e.Subject, e.Methods = user.GetPID(), user.GetSubject(), auth.AMR
+	audit.Record(r, e)
+
+	http.Redirect(w, r, res.RedirectTo, http.StatusFound)
+}
+
+// loginAuditEvent describes the outcome of a Hydra login request
+func loginAuditEvent(typ, ch string, req LoginRequest, reason string) audit.Event {
+	return audit.Event{
+		Type:      typ,
+		Subject:   req.Subject,
+		ClientID:  req.Client.ClientID,
+		Scopes:    req.RequestedScope,
+		Challenge: ch,
+		Reason:    reason,
+	}
+}
+
+// sessionUser returns the user of the current authboss session and how they
+// authenticated, as long as the session satisfies the max_age of the login
+// request. Sessions that do not record when the user authenticated are too
+// old for any request, as Hydra must not be handed a made up auth_time.
+func sessionUser(ab *authboss.Authboss, r *http.Request, req LoginRequest) (*model.User, authentication, bool) {
+	user, err := model.GetUser(ab, &r)
+	if err != nil || user == nil || user.IsDisabled() {
+		return nil, authentication{}, false
+	}
+
+	auth := sessionAuthentication(r)
+	if auth.Time.IsZero() {
+		return nil, authentication{}, false
+	}
+	if maxAge, ok := req.MaxAge(); ok && time.Since(auth.Time) > maxAge {
+		return nil, authentication{}, false
+	}
+
+	if req.WantsACR(StepUpACRValues...) && auth.ACR() != ACRMultiFactor {
+		return nil, authentication{}, false
+	}
+
+	return user, auth, true
+}
+
+// withLoginRequest stores the login request on the context and exposes it
+// to the templates.
+func withLoginRequest(r *http.Request, ch string, req LoginRequest) *http.Request {
+	ctx := context.WithValue(r.Context(), CTXKeyChallenge, ch)
+	ctx = context.WithValue(ctx, CTXKeyLoginRequest, req)
+	r = r.WithContext(ctx)
+
+	data := authboss.HTMLData{
+		"challenge":     ch,
+		"login_request": req,
+		"client_name":   req.Client.DisplayName(),
+		"login_hint":    req.OIDCContext.LoginHint,
+		"mfa_required":  req.WantsACR(StepUpACRValues...),
+	}
+	if lang, ok := i18n.Match(req.OIDCContext.UILocales...); ok {
+		r = i18n.WithLocale(r, lang)
+		data.MergeKV("lang", lang, "t", i18n.Get(lang))
+	}
+
+	if d, ok := r.Context().Value(authboss.CTXKeyData).(authboss.HTMLData); ok {
+		r = r.WithContext(context.WithValue(r.Context(), authboss.CTXKeyData, d.Merge(data)))
+	}
+
+	return r
+}
+
+// hasSecondFactor reports whether the user has enrolled a second factor
+func hasSecondFactor(user *model.User) bool {
+	return user.GetTOTPSecretKey() != "" || user.GetSMSPhoneNumber() != ""
+}
@@ -4,43 +4,148 @@ import (
 	"net/http"
 
 	"github.com/volatiletech/authboss"
+
+	"github.com/nbycomp/login-consent/audit"
+	"github.com/nbycomp/login-consent/logging"
+	"github.com/nbycomp/login-consent/model"
 )
 
+// PageLogout asks the user to confirm they want to log out
+const PageLogout = "logout"
+
 type getLogoutResponse struct {
+	Subject     string `json:"subject"`
+	SessionID   string `json:"sid"`
+	RequestURL  string `json:"request_url"`
+	RPInitiated bool   `json:"rp_initiated"`
 }
 
-func getLogoutRequest(challenge string) getLogoutResponse {
+func (h *Hydra) getLogoutRequest(challenge string) (getLogoutResponse, error) {
 	var res getLogoutResponse
-	url := makeGetURL(logout, challenge)
-	getJSON(url, &res)
+	url := h.makeGetURL(logout, challenge)
+	err := h.getJSON(url, &res)
 
-	return res
+	return res, err
 }
 
 type acceptLogoutResponse struct {
 	RedirectTo string `json:"redirect_to"`
 }
 
-func acceptLogoutRequest(challenge string) acceptLogoutResponse {
+func (h *Hydra) acceptLogoutRequest(challenge string) (acceptLogoutResponse, error) {
 	var res acceptLogoutResponse
-	url := makeAcceptURL(logout, challenge)
-	putJSON(url, nil, &res)
+	url := h.makeAcceptURL(logout, challenge)
+	err := h.putJSON(url, nil, &res)
+
+	return res, err
+}
 
-	return res
+func (h *Hydra) rejectLogoutRequest(challenge string) error {
+	url := h.makeRejectURL(logout, challenge)
+	return h.putJSON(url, rejectRequest{Error: "access_denied"}, nil)
 }
 
-func LogoutMiddleware(ab *authboss.Authboss) Middleware {
+// LogoutMiddleware completes Hydra logout requests. Without a challenge the
+// request is passed on to the authboss logout module. With confirm, users
+// are shown PageLogout before the request is accepted instead of being
+// logged out straight away, where they can also choose to sign out of every
+// application.
+func LogoutMiddleware(ab *authboss.Authboss, h *Hydra, confirm bool) Middleware {
 	return func(handler http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			if r.URL.Path == "/logout" && r.Method == http.MethodGet {
-				if ch := r.URL.Query().Get("logout_challenge"); ch != "" {
-					getLogoutRequest(ch)
-					res := acceptLogoutRequest(ch)
-					ab.Paths.LogoutOK = res.RedirectTo
+			if r.URL.Path != "/logout" {
+				handler.ServeHTTP(w, r)
+				return
+			}
+
+			var ch string
+			switch r.Method {
+			case http.MethodGet:
+				ch = r.URL.Query().Get("logout_challenge")
+			case http.MethodPost:
+				ch = r.FormValue("challenge")
+			}
+			if ch == "" {
+				if user, err := model.GetUser(ab, &r); err == nil && user != nil {
+					audit.Record(r, audit.Event{Type: audit.Logout, User: user.GetPID(), Subject: user.GetSubject()})
 				}
+				handler.ServeHTTP(w, r)
+				return
 			}
+			logging.AddFields(r.Context(), "logout_challenge", ch)
 
-			handler.ServeHTTP(w, r)
+			req, err := h.getLogoutRequest(ch)
+			if err != nil {
+				renderError(ab, w, r, http.StatusBadGateway, "error_hydra", err)
+				return
+			}
+
+			switch {
+			case r.Method == http.MethodGet && confirm:
+				data := authboss.HTMLData{"challenge": ch}
+				if err := ab.Core.Responder.Respond(w, r, http.StatusOK, PageLogout, data); err != nil {
+					renderError(ab, w, r, http.StatusInternalServerError, "error_generic", err)
+				}
+			case r.Method == http.MethodPost && r.FormValue("confirm") != "true":
+				if err := h.rejectLogoutRequest(ch); err != nil {
+					renderError(ab, w, r, http.StatusBadGateway, "error_hydra", err)
+					return
+				}
+				audit.Record(r, audit.Event{Type: audit.LogoutRejected, Subject: req.Subject, Challenge: ch})
+				http.Redirect(w, r, ab.Paths.LogoutOK, http.StatusFound)
+			default:
+				everywhere := r.Method == http.MethodPost && r.FormValue("everywhere") == "true"
+				acceptLogout(ab, h, w, r, ch, req, everywhere)
+			}
 		})
 	}
 }
+
+// acceptLogout ends the authboss session and the Hydra login sessions of the
+// subject, then sends the user on to wherever Hydra asks. The applications
+// keep the access they were granted unless everywhere is set, which also
+// revokes the consent given to every application and the tokens issued
+// under it.
+func acceptLogout(ab *authboss.Authboss, h *Hydra, w http.ResponseWriter, r *http.Request, ch string, req getLogoutResponse, everywhere bool) {
+	logger := ab.RequestLogger(r)
+
+	res, err := h.acceptLogoutRequest(ch)
+	if err != nil {
+		renderError(ab, w, r, http.StatusBadGateway, "error_hydra", err)
+		return
+	}
+
+	authboss.DelAllSession(w, ab.Config.Storage.SessionStateWhitelistKeys)
+	authboss.DelKnownSession(w)
+	authboss.DelKnownCookie(w)
+
+	if req.Subject != "" {
+		if user, err := loadBySubject(ab, r.Context(), req.Subject); err == nil {
+			if storer, ok := ab.Config.Storage.Server.(authboss.RememberingServerStorer); ok {
+				if err := storer.DelRememberTokens(r.Context(), user.GetPID()); err != nil {
+					logger.Errorf("failed to delete remember tokens of %s: %v", req.Subject, err)
+				}
+			}
+		}
+
+		if err := h.revokeLoginSessions(req.Subject); err != nil {
+			logger.Errorf("failed to revoke login sessions of %s: %v", req.Subject, err)
+		}
+		if everywhere {
+			if err := h.revokeConsentSessions(req.Subject, ""); err != nil {
+				logger.Errorf("failed to revoke consent sessions of %s: %v", req.Subject, err)
+			}
+		}
+	}
+
+	e := audit.Event{Type: audit.LogoutAccepted, Subject: req.Subject, Challenge: ch}
+	if everywhere {
+		logger.Infof("subject %s logged out of every application", req.Subject)
+		e.Reason = "signed out everywhere"
+	} else {
+		logger.Infof("subject %s logged out", req.Subject)
+	}
+	audit.Record(r, e)
+
+	http.Redirect(w, r, res.RedirectTo, http.StatusFound)
+}
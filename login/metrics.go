@@ -0,0 +1,111 @@
+package login
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/volatiletech/authboss"
+
+	"github.com/nbycomp/login-consent/metrics"
+	"github.com/nbycomp/login-consent/model"
+)
+
+// metricsTransport records the latency and outcome of Hydra admin calls
+type metricsTransport struct {
+	next    http.RoundTripper
+	metrics *metrics.Metrics
+}
+
+func (t metricsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	flow, op := hydraOperation(req)
+
+	start := time.Now()
+	res, err := t.next.RoundTrip(req)
+	t.metrics.HydraDuration.WithLabelValues(flow, op).Observe(time.Since(start).Seconds())
+
+	outcome := "success"
+	switch {
+	case err != nil:
+		outcome = "unreachable"
+	case res.StatusCode < 200 || res.StatusCode > 299:
+		outcome = "error"
+	}
+	t.metrics.HydraRequests.WithLabelValues(flow, op, outcome).Inc()
+
+	return res, err
+}
+
+// hydraOperation names a call to one of the admin routes in client.go, e.g.
+// /oauth2/auth/requests/login/accept is the accept operation of the login
+// flow and DELETE /oauth2/auth/sessions/consent revokes consent sessions.
+func hydraOperation(req *http.Request) (flow, op string) {
+	if req.URL.Path == "/health/ready" {
+		return "health", "ready"
+	}
+
+	parts := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+	if len(parts) < 4 || parts[0] != "oauth2" || parts[1] != "auth" {
+		return "other", strings.ToLower(req.Method)
+	}
+
+	switch parts[2] {
+	case "requests":
+		op = "get"
+		if len(parts) > 4 {
+			op = parts[4]
+		}
+		return parts[3], op
+	case "sessions":
+		op = "list"
+		if req.Method == http.MethodDelete {
+			op = "revoke"
+		}
+		return parts[3] + "_sessions", op
+	}
+
+	return "other", strings.ToLower(req.Method)
+}
+
+// Metrics counts authentication attempts and lockouts in m
+func Metrics(ab *authboss.Authboss, m *metrics.Metrics) {
+	ab.Events.After(authboss.EventAuth, func(w http.ResponseWriter, r *http.Request, handled bool) (bool, error) {
+		m.AuthAttempts.WithLabelValues("success", authMethod(r)).Inc()
+		return false, nil
+	})
+
+	ab.Events.After(authboss.EventOAuth2, func(w http.ResponseWriter, r *http.Request, handled bool) (bool, error) {
+		m.AuthAttempts.WithLabelValues("success", AMRFederated).Inc()
+		return false, nil
+	})
+
+	ab.Events.After(authboss.EventOAuth2Fail, func(w http.ResponseWriter, r *http.Request, handled bool) (bool, error) {
+		m.AuthAttempts.WithLabelValues("failure", AMRFederated).Inc()
+		return false, nil
+	})
+
+	// The lock module handles the failure that locks the account, so the
+	// user is checked once every handler has run
+	ab.Events.After(authboss.EventAuthFail, func(w http.ResponseWriter, r *http.Request, handled bool) (bool, error) {
+		m.AuthAttempts.WithLabelValues("failure", authMethod(r)).Inc()
+
+		if user, ok := r.Context().Value(authboss.CTXKeyUser).(*model.User); ok && handled && user.GetLocked().After(time.Now()) {
+			m.Lockouts.Inc()
+		}
+
+		return false, nil
+	})
+}
+
+// authMethod is the method proven by the attempt, the second factor for
+// two-factor validation
+func authMethod(r *http.Request) string {
+	amr := authenticationFor(r).AMR
+	for _, m := range amr {
+		if m == AMROTP || m == AMRSMS {
+			return m
+		}
+	}
+
+	return amr[0]
+}
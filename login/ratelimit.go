@@ -0,0 +1,90 @@
+package login
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/volatiletech/authboss"
+	"github.com/volatiletech/authboss/otp/twofactor/totp2fa"
+
+	"github.com/nbycomp/login-consent/i18n"
+	"github.com/nbycomp/login-consent/logging"
+	"github.com/nbycomp/login-consent/metrics"
+	"github.com/nbycomp/login-consent/ratelimit"
+)
+
+// rateLimitedPaths are the authboss routes whose POSTs guess at a password
+// or a code
+var rateLimitedPaths = map[string]bool{
+	"/login":              true,
+	"/2fa/totp/validate":  true,
+	"/2fa/totp/confirm":   true,
+	"/2fa/totp/remove":    true,
+	"/2fa/recovery/regen": true,
+}
+
+// RateLimitMiddleware throttles attempts to log in and to verify a second
+// factor, per client IP and per account. It must run before LoginMiddleware,
+// so throttled attempts are not passed on to Hydra. The login page shown when
+// a limit is hit keeps the Hydra challenge of the form, so the user can try
+// again later. Refused requests are counted in m.
+func RateLimitMiddleware(ab *authboss.Authboss, perIP, perAccount *ratelimit.Limiter, clientIP func(*http.Request) string, m *metrics.Metrics) Middleware {
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost || !rateLimitedPaths[r.URL.Path] {
+				handler.ServeHTTP(w, r)
+				return
+			}
+
+			limit := "ip"
+			ok, wait := perIP.Allow(clientIP(r))
+			if account := rateLimitAccount(r); ok && account != "" {
+				limit = "account"
+				ok, wait = perAccount.Allow(account)
+			}
+			if ok {
+				handler.ServeHTTP(w, r)
+				return
+			}
+
+			m.RateLimited.WithLabelValues(limit).Inc()
+			logging.FromContext(r.Context()).Warn("rate limited", "limit", limit)
+
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+
+			if r.URL.Path != "/login" {
+				renderError(ab, w, r, http.StatusTooManyRequests, "error_rate_limited", nil)
+				return
+			}
+
+			data := authboss.HTMLData{
+				authboss.DataErr: i18n.T(r, "error_rate_limited"),
+				"primaryIDValue": r.FormValue("email"),
+			}
+			if ch := r.FormValue("challenge"); ch != "" {
+				data["challenge"] = ch
+			}
+			if err := ab.Core.Responder.Respond(w, r, http.StatusTooManyRequests, "login", data); err != nil {
+				renderError(ab, w, r, http.StatusTooManyRequests, "error_rate_limited", nil)
+			}
+		})
+	}
+}
+
+// rateLimitAccount is the account an attempt is made on: the address typed
+// in, or the user half way through a login or logged in
+func rateLimitAccount(r *http.Request) string {
+	if email := strings.ToLower(strings.TrimSpace(r.FormValue("email"))); email != "" {
+		return email
+	}
+	if pid, ok := authboss.GetSession(r, totp2fa.SessionTOTPPendingPID); ok && pid != "" {
+		return pid
+	}
+	if pid, ok := authboss.GetSession(r, authboss.SessionKey); ok {
+		return pid
+	}
+
+	return ""
+}
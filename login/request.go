@@ -0,0 +1,121 @@
+package login
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Client is the part of a Hydra OAuth2 client shown to users
+type Client struct {
+	ClientID   string   `json:"client_id"`
+	ClientName string   `json:"client_name"`
+	ClientURI  string   `json:"client_uri"`
+	LogoURI    string   `json:"logo_uri"`
+	PolicyURI  string   `json:"policy_uri"`
+	TosURI     string   `json:"tos_uri"`
+	Contacts   []string `json:"contacts"`
+	Scope      string   `json:"scope"`
+	Audience   []string `json:"audience"`
+
+	RedirectURIs []string `json:"redirect_uris"`
+
+	SectorIdentifierURI string `json:"sector_identifier_uri"`
+	SubjectType         string `json:"subject_type"`
+}
+
+// DisplayName is the client name, falling back to the client ID
+func (c Client) DisplayName() string {
+	if c.ClientName != "" {
+		return c.ClientName
+	}
+
+	return c.ClientID
+}
+
+// OIDCContext holds the OpenID Connect parameters of the authorization request
+type OIDCContext struct {
+	ACRValues         []string               `json:"acr_values"`
+	Display           string                 `json:"display"`
+	IDTokenHintClaims map[string]interface{} `json:"id_token_hint_claims"`
+	LoginHint         string                 `json:"login_hint"`
+	UILocales         []string               `json:"ui_locales"`
+}
+
+// LoginRequest is the login request returned by Hydra's admin API
+type LoginRequest struct {
+	Challenge                    string      `json:"challenge"`
+	Skip                         bool        `json:"skip"`
+	Subject                      string      `json:"subject"`
+	Client                       Client      `json:"client"`
+	RequestURL                   string      `json:"request_url"`
+	RequestedScope               []string    `json:"requested_scope"`
+	RequestedAccessTokenAudience []string    `json:"requested_access_token_audience"`
+	OIDCContext                  OIDCContext `json:"oidc_context"`
+	SessionID                    string      `json:"session_id"`
+}
+
+// requestParam returns a query parameter of the original authorization request
+func (l LoginRequest) requestParam(key string) string {
+	u, err := url.Parse(l.RequestURL)
+	if err != nil {
+		return ""
+	}
+
+	return u.Query().Get(key)
+}
+
+// Prompt returns the space separated values of the prompt parameter
+func (l LoginRequest) Prompt() []string {
+	return strings.Fields(l.requestParam("prompt"))
+}
+
+// ForceLogin reports whether the client asked for the user to
+// re-authenticate with prompt=login.
+func (l LoginRequest) ForceLogin() bool {
+	for _, p := range l.Prompt() {
+		if p == "login" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// MaxAge returns the max_age parameter, and false if it was not sent
+func (l LoginRequest) MaxAge() (time.Duration, bool) {
+	v := l.requestParam("max_age")
+	if v == "" {
+		return 0, false
+	}
+
+	secs, err := strconv.Atoi(v)
+	if err != nil || secs < 0 {
+		return 0, false
+	}
+
+	return time.Duration(secs) * time.Second, true
+}
+
+// WantsACR reports whether any of the given authentication context class
+// references was requested through acr_values.
+func (l LoginRequest) WantsACR(acrs ...string) bool {
+	for _, v := range l.OIDCContext.ACRValues {
+		for _, acr := range acrs {
+			if v == acr {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// GetLoginRequest returns the Hydra login request of the current flow, as
+// stored on the request context by LoginMiddleware.
+func GetLoginRequest(r *http.Request) (LoginRequest, bool) {
+	req, ok := r.Context().Value(CTXKeyLoginRequest).(LoginRequest)
+	return req, ok
+}
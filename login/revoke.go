@@ -0,0 +1,131 @@
+package login
+
+import (
+	"sync"
+	"time"
+
+	"github.com/nbycomp/login-consent/logging"
+)
+
+const (
+	revokeAttempts  = 5
+	revokeBackoff   = 5 * time.Second
+	revokeQueueSize = 100
+)
+
+type revocation struct {
+	subject  string
+	clientID string
+	attempt  int
+}
+
+// Revoker revokes the Hydra login and consent sessions of users that were
+// disabled or deleted. Failed revocations are retried in the background with
+// an increasing delay.
+type Revoker struct {
+	hydra *Hydra
+	log   *logging.Logger
+	queue chan revocation
+
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+// NewRevoker starts a Revoker, which runs until it is closed
+func NewRevoker(h *Hydra, log *logging.Logger) *Revoker {
+	r := &Revoker{
+		hydra: h,
+		log:   log,
+		queue: make(chan revocation, revokeQueueSize),
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	go r.run()
+
+	return r
+}
+
+// Revoke queues the revocation of the subject's sessions. With client IDs
+// only the consent given to those clients is revoked. It does not block:
+// when the queue is full the revocation is dropped and logged.
+func (r *Revoker) Revoke(subject string, clientIDs ...string) {
+	if len(clientIDs) == 0 {
+		r.enqueue(revocation{subject: subject})
+		return
+	}
+
+	for _, id := range clientIDs {
+		r.enqueue(revocation{subject: subject, clientID: id})
+	}
+}
+
+// Close stops the revoker once the revocation in progress is done. Queued
+// revocations and pending retries are dropped.
+func (r *Revoker) Close() error {
+	r.once.Do(func() { close(r.stop) })
+	<-r.done
+
+	if n := len(r.queue); n > 0 {
+		r.log.Warn("dropped queued revocations of hydra sessions on close", "count", n)
+	}
+
+	return nil
+}
+
+func (r *Revoker) enqueue(rev revocation) {
+	// Nothing reads the queue once the revoker is closed
+	select {
+	case <-r.stop:
+		r.hydra.metrics.RevocationsDropped.Inc()
+		r.log.Warn("revoker is closed, dropping revocation of hydra sessions", "subject", rev.subject, "client_id", rev.clientID)
+		return
+	default:
+	}
+
+	select {
+	case r.queue <- rev:
+	default:
+		r.hydra.metrics.RevocationsDropped.Inc()
+		r.log.Error("revocation queue is full, dropping revocation of hydra sessions", "subject", rev.subject, "client_id", rev.clientID)
+	}
+}
+
+func (r *Revoker) run() {
+	defer close(r.done)
+
+	for {
+		var rev revocation
+		select {
+		case <-r.stop:
+			return
+		case rev = <-r.queue:
+		}
+
+		err := r.revoke(rev)
+		if err == nil {
+			r.log.Info("revoked hydra sessions", "subject", rev.subject, "client_id", rev.clientID)
+			continue
+		}
+
+		rev.attempt++
+		if rev.attempt >= revokeAttempts {
+			r.log.Error("giving up revoking hydra sessions", "subject", rev.subject, "client_id", rev.clientID, "error", err)
+			continue
+		}
+
+		delay := revokeBackoff * time.Duration(1<<uint(rev.attempt-1))
+		r.log.Warn("failed to revoke hydra sessions, retrying", "subject", rev.subject, "client_id", rev.clientID, "retry_in", delay.String(), "error", err)
+		time.AfterFunc(delay, func() { r.enqueue(rev) })
+	}
+}
+
+func (r *Revoker) revoke(rev revocation) error {
+	if rev.clientID == "" {
+		if err := r.hydra.revokeLoginSessions(rev.subject); err != nil {
+			return err
+		}
+	}
+
+	return r.hydra.revokeConsentSessions(rev.subject, rev.clientID)
+}
@@ -0,0 +1,113 @@
+package login_test
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nbycomp/login-consent/config"
+	"github.com/nbycomp/login-consent/hydratest"
+	"github.com/nbycomp/login-consent/logging"
+	"github.com/nbycomp/login-consent/login"
+	"github.com/nbycomp/login-consent/metrics"
+)
+
+func newRevoker(t *testing.T, hydraURL string, w io.Writer) *login.Revoker {
+	t.Helper()
+
+	cfg := config.Default()
+	cfg.HydraAdminURL = hydraURL
+	log := logging.New(w, logging.LevelWarn, logging.FormatJSON)
+	h, err := login.NewHydra(cfg, log, metrics.New(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return login.NewRevoker(h, log)
+}
+
+func TestRevokerRevokesSessions(t *testing.T) {
+	hydra := hydratest.NewServer()
+	defer hydra.Close()
+
+	r := newRevoker(t, hydra.URL, ioutil.Discard)
+	defer r.Close()
+	r.Revoke("sub")
+
+	want := map[string]bool{"/oauth2/auth/sessions/login": true, "/oauth2/auth/sessions/consent": true}
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		for _, call := range hydra.Calls() {
+			if call.Method == http.MethodDelete && call.Query.Get("subject") == "sub" {
+				delete(want, call.Path)
+			}
+		}
+		if len(want) == 0 {
+			return
+		}
+	}
+
+	t.Errorf("the sessions at %v were not revoked", want)
+}
+
+func TestRevokeDoesNotBlockWhenTheQueueIsFull(t *testing.T) {
+	release := make(chan struct{})
+	hydra := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer hydra.Close()
+
+	r := newRevoker(t, hydra.URL, ioutil.Discard)
+
+	queued := make(chan struct{})
+	go func() {
+		for i := 0; i < 1000; i++ {
+			r.Revoke("sub")
+		}
+		close(queued)
+	}()
+
+	select {
+	case <-queued:
+	case <-time.After(5 * time.Second):
+		t.Error("Revoke blocked while the queue was full")
+	}
+
+	closed := make(chan error)
+	go func() { closed <- r.Close() }()
+	close(release)
+
+	select {
+	case err := <-closed:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close did not return")
+	}
+}
+
+func TestRevokeAfterClose(t *testing.T) {
+	hydra := hydratest.NewServer()
+	defer hydra.Close()
+
+	var buf bytes.Buffer
+	r := newRevoker(t, hydra.URL, &buf)
+	r.Close()
+	r.Revoke("sub", "client")
+
+	if !strings.Contains(buf.String(), "revoker is closed, dropping revocation") || !strings.Contains(buf.String(), `"client_id":"client"`) {
+		t.Errorf("the revocation after Close was not logged as dropped:\n%s", buf.String())
+	}
+	if err := r.Close(); err != nil {
+		t.Error(err)
+	}
+	if strings.Contains(buf.String(), "dropped queued revocations") {
+		t.Errorf("the revocation after Close was queued:\n%s", buf.String())
+	}
+}
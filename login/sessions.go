@@ -0,0 +1,14 @@
+package login
+
+// revokeLoginSessions forgets that Hydra authenticated the subject, so the
+// next authorization request prompts for credentials again
+func (h *Hydra) revokeLoginSessions(subject string) error {
+	return h.deleteRequest(h.makeSessionsURL(login, subject, ""))
+}
+
+// revokeConsentSessions revokes the consent the subject granted to clientID,
+// or to all clients when clientID is empty, along with the tokens issued
+// under it
+func (h *Hydra) revokeConsentSessions(subject, clientID string) error {
+	return h.deleteRequest(h.makeSessionsURL(consent, subject, clientID))
+}
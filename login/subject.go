@@ -0,0 +1,68 @@
+package login
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/url"
+
+	"github.com/volatiletech/authboss"
+
+	"github.com/nbycomp/login-consent/model"
+)
+
+// SubjectStorer loads users by the subject identifier sent to Hydra
+type SubjectStorer interface {
+	LoadBySubject(ctx context.Context, subject string) (authboss.User, error)
+}
+
+// loadBySubject resolves a Hydra subject to a user through the server storer
+func loadBySubject(ab *authboss.Authboss, ctx context.Context, subject string) (*model.User, error) {
+	storer, ok := ab.Config.Storage.Server.(SubjectStorer)
+	if !ok {
+		return nil, authboss.ErrUserNotFound
+	}
+
+	user, err := storer.LoadBySubject(ctx, subject)
+	if err != nil {
+		return nil, err
+	}
+
+	return user.(*model.User), nil
+}
+
+// sectorIdentifier is the host the pairwise subject is computed for, taken
+// from the client's sector_identifier_uri or its only redirect URI.
+func sectorIdentifier(c Client) string {
+	raw := c.SectorIdentifierURI
+	if raw == "" {
+		if len(c.RedirectURIs) != 1 {
+			return ""
+		}
+		raw = c.RedirectURIs[0]
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+
+	return u.Host
+}
+
+// pairwiseSubject derives the subject identifier for the client as described
+// in section 8.1 of OpenID Connect Core. It returns false when the client
+// does not use pairwise subjects.
+func (h *Hydra) pairwiseSubject(c Client, subject string) (string, bool) {
+	if c.SubjectType != "pairwise" || h.pairwiseSalt == "" {
+		return "", false
+	}
+
+	sector := sectorIdentifier(c)
+	if sector == "" {
+		return "", false
+	}
+
+	sum := sha256.Sum256([]byte(sector + subject + h.pairwiseSalt))
+	return base64.RawURLEncoding.EncodeToString(sum[:]), true
+}
@@ -1,160 +1,72 @@
 package main
 
 import (
-	"context"
-	"encoding/base64"
-	"log"
-	"net/http"
-	"net/url"
+	"flag"
+	"fmt"
 	"os"
-	"time"
+	"os/signal"
+	"syscall"
 
-	"github.com/go-chi/chi"
-	"github.com/gorilla/schema"
-	"github.com/gorilla/securecookie"
-	"github.com/gorilla/sessions"
-	"github.com/justinas/nosurf"
-	"github.com/nbycomp/login-consent/login"
-	"github.com/nbycomp/login-consent/model"
-	"github.com/nbycomp/login-consent/repo"
-	"github.com/volatiletech/authboss"
-	abclientstate "github.com/volatiletech/authboss-clientstate"
-	abrenderer "github.com/volatiletech/authboss-renderer"
-	_ "github.com/volatiletech/authboss/auth"
-	"github.com/volatiletech/authboss/defaults"
-	_ "github.com/volatiletech/authboss/logout"
-)
-
-const (
-	sessionCookieName = "nbycomp"
-)
-
-var (
-	flagDebug    = false
-	flagDebugDB  = false
-	flagDebugCTX = false
-)
-
-var (
-	ab        = authboss.New()
-	database  = repo.NewMemStorer()
-	schemaDec = schema.NewDecoder()
-
-	sessionStore abclientstate.SessionStorer
-	cookieStore  abclientstate.CookieStorer
+	"github.com/nbycomp/login-consent/audit"
+	"github.com/nbycomp/login-consent/config"
+	"github.com/nbycomp/login-consent/logging"
+	"github.com/nbycomp/login-consent/server"
 )
 
 func main() {
-	cookieStore = abclientstate.NewCookieStorer(storeKey("COOKIE_STORE_KEY"), nil)
-	cookieStore.Secure = false
-	sessionStore = abclientstate.NewSessionStorer(sessionCookieName, storeKey("SESSION_STORE_KEY"), nil)
-
-	cStore := sessionStore.Store.(*sessions.CookieStore)
-	cStore.Options.Secure = false
-	cStore.MaxAge(int((30 * 24 * time.Hour) / time.Second))
-
-	ab.Config.Storage.Server = database
-	ab.Config.Storage.SessionState = sessionStore
-	ab.Config.Storage.CookieState = cookieStore
-
-	if filename := os.Getenv("IMPORT_USERS"); filename != "" {
-		log.Printf("Importing users from file: %s\n", filename)
-		repo.Import(filename, database)
+	cfg, err := config.Load(os.Args[1:])
+	if err == flag.ErrHelp {
+		os.Exit(0)
 	}
-
-	ab.Config.Paths.Mount = "/auth"
-	ab.Config.Core.ViewRenderer = abrenderer.NewHTML(ab.Config.Paths.Mount, "ab_views")
-	ab.Config.Modules.LogoutMethod = http.MethodGet
-	ab.Config.Modules.RegisterPreserveFields = []string{"email", "name"}
-
-	port := os.Getenv("PORT")
-	if len(port) == 0 {
-		port = "3000"
+	if err == nil {
+		err = server.Validate(cfg)
 	}
-
-	rootURL := os.Getenv("ROOT_URL")
-	if rootURL == "" {
-		rootURL = "http://localhost:" + port
-	}
-	_, err := url.Parse(rootURL)
 	if err != nil {
-		panic("invalid root URL passed")
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
 	}
-	ab.Config.Paths.RootURL = rootURL
 
-	defaults.SetCore(&ab.Config, false, false)
+	level, _ := logging.ParseLevel(cfg.LogLevel)
+	log := logging.New(os.Stdout, level, cfg.LogFormat)
+	log.Info("configuration", "config", cfg.Redacted())
 
-	if err := ab.Init(); err != nil {
-		panic(err)
+	var sink audit.Sink = audit.Discard{}
+	if filename := cfg.AuditLog; filename != "" {
+		if sink, err = audit.OpenFile(filename); err != nil {
+			log.Fatal("failed to open audit log", "file", filename, "error", err)
+		}
 	}
 
-	schemaDec.IgnoreUnknownKeys(true)
-
-	mux := chi.NewRouter()
-
-	mux.Use(logger,
-		nosurf.NewPure,
-		ab.LoadClientStateMiddleware,
-		dataInjector,
-		authboss.ModuleListMiddleware(ab),
-	)
-
-	mux.Route(ab.Config.Paths.Mount, func(mux chi.Router) {
-		mws := chi.Chain(login.LoginMiddleware(ab), login.LogoutMiddleware(ab))
-		mux.Mount("/", http.StripPrefix(ab.Config.Paths.Mount, mws.Handler(ab.Config.Core.Router)))
-		mux.Mount("/consent", login.Consent(ab))
-
-		fs := http.FileServer(http.Dir("static"))
-		mux.Mount("/static/", http.StripPrefix(ab.Config.Paths.Mount+"/static/", fs))
-	})
-
-	log.Printf("Listening on port %s", port)
-	log.Println(http.ListenAndServe(":"+port, mux))
-}
-
-func dataInjector(handler http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		data := layoutData(w, &r)
-		r = r.WithContext(context.WithValue(r.Context(), authboss.CTXKeyData, data))
-		handler.ServeHTTP(w, r)
-	})
-}
+	srv, err := server.New(cfg, server.WithLogger(log), server.WithAuditSink(sink))
+	if err != nil {
+		log.Fatal("failed to set up the server", "error", err)
+	}
 
-// layoutData is passing pointers to pointers be able to edit the current pointer
-// to the request. This is still safe as it still creates a new request and doesn't
-// modify the old one, it just modifies what we're pointing to in our methods so
-// we're able to skip returning an *http.Request everywhere
-func layoutData(w http.ResponseWriter, r **http.Request) authboss.HTMLData {
-	var loggedIn bool
-	var currentUserName string
+	if filename := cfg.ImportUsers; filename != "" {
+		go func() {
+			if err := srv.ImportUsers(); err != nil {
+				log.Fatal("failed to import users", "file", filename, "error", err)
+			}
 
-	if user, err := model.GetUser(ab, r); user != nil && err == nil {
-		loggedIn = true
-		currentUserName = user.Name
+			syncUsersOnHangup(srv, filename, log)
+		}()
 	}
 
-	return authboss.HTMLData{
-		"loggedin":          loggedIn,
-		"current_user_name": currentUserName,
-		"csrf_token":        nosurf.Token(*r),
-		"flash_success":     authboss.FlashSuccess(w, *r),
-		"flash_error":       authboss.FlashError(w, *r),
-	}
+	public := srv.NewHTTPServer(":"+cfg.Port, srv)
+	public.TLSConfig = srv.TLSConfig()
+
+	os.Exit(serve(srv, log, sink, public, srv.NewHTTPServer(":"+cfg.MetricsPort, srv.MetricsHandler())))
 }
 
-func storeKey(envKey string) []byte {
-	key := os.Getenv(envKey)
-	if key == "" {
-		log.Printf("generating random 64 byte key (override by setting %s to a base64-encoded string)\n", envKey)
-		return securecookie.GenerateRandomKey(64)
-	}
+// syncUsersOnHangup reloads the users file every time the process receives
+// SIGHUP, revoking the access of users that were removed or disabled
+func syncUsersOnHangup(srv *server.Server, filename string, log *logging.Logger) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGHUP)
 
-	decoded, err := base64.StdEncoding.DecodeString(key)
-	if err != nil {
-		log.Fatalf("failed to base64-decode %s", envKey)
-	} else if len(decoded) != 64 {
-		log.Fatalf("%s is the incorrect length, should be 64 bytes", envKey)
+	for range c {
+		if err := srv.ReloadUsers(); err != nil {
+			log.Error("failed to reload users", "file", filename, "error", err)
+		}
 	}
-
-	return decoded
 }
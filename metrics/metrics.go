@@ -0,0 +1,168 @@
+// Package metrics holds the Prometheus collectors of the service and the
+// handler exposing them.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "login_consent"
+
+// Metrics holds the collectors of a server, registered on a registry of
+// their own so that servers in the same process report separately
+type Metrics struct {
+	// HTTPRequests counts the requests served by route, method and status
+	HTTPRequests *prometheus.CounterVec
+
+	// HTTPDuration observes the time taken to serve requests
+	HTTPDuration *prometheus.HistogramVec
+
+	// HydraRequests counts the calls to the Hydra admin API by flow,
+	// operation and outcome
+	HydraRequests *prometheus.CounterVec
+
+	// HydraDuration observes the latency of the Hydra admin API
+	HydraDuration *prometheus.HistogramVec
+
+	// AuthAttempts counts authentication attempts by result and method
+	AuthAttempts *prometheus.CounterVec
+
+	// Lockouts counts the accounts locked after too many failed attempts
+	Lockouts prometheus.Counter
+
+	// RateLimited counts the requests refused for exceeding a rate limit, by
+	// the limit exceeded
+	RateLimited *prometheus.CounterVec
+
+	// RevocationsDropped counts the revocations of Hydra sessions dropped
+	// because the queue of the revoker was full or it was closed
+	RevocationsDropped prometheus.Counter
+
+	// ConsentDecisions counts consent requests by decision
+	ConsentDecisions *prometheus.CounterVec
+
+	registry *prometheus.Registry
+}
+
+// New creates the collectors along with those of the Go runtime and the
+// process. The users gauge reports userCount, which may be nil.
+func New(userCount func() int) *Metrics {
+	m := &Metrics{
+		HTTPRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests served, by route, method and status code.",
+		}, []string{"route", "method", "status"}),
+		HTTPDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Time taken to serve HTTP requests, by route and method.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method"}),
+		HydraRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "hydra_requests_total",
+			Help:      "Calls to the Hydra admin API, by flow, operation and outcome.",
+		}, []string{"flow", "operation", "outcome"}),
+		HydraDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "hydra_request_duration_seconds",
+			Help:      "Latency of calls to the Hydra admin API, by flow and operation.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"flow", "operation"}),
+		AuthAttempts: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "auth_attempts_total",
+			Help:      "Authentication attempts, by result and method.",
+		}, []string{"result", "method"}),
+		Lockouts: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "lockouts_total",
+			Help:      "Accounts locked after too many failed authentication attempts.",
+		}),
+		RateLimited: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "rate_limited_total",
+			Help:      "Requests refused for exceeding a rate limit, by limit.",
+		}, []string{"limit"}),
+		RevocationsDropped: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "revocations_dropped_total",
+			Help:      "Revocations of Hydra sessions dropped because the queue was full or the revoker was closed.",
+		}),
+		ConsentDecisions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "consent_decisions_total",
+			Help:      "Consent requests, by decision.",
+		}, []string{"decision"}),
+		registry: prometheus.NewRegistry(),
+	}
+
+	users := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "users",
+		Help:      "Users in the user store.",
+	}, func() float64 {
+		if userCount == nil {
+			return 0
+		}
+		return float64(userCount())
+	})
+
+	m.registry.MustRegister(
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+		m.HTTPRequests,
+		m.HTTPDuration,
+		m.HydraRequests,
+		m.HydraDuration,
+		m.AuthAttempts,
+		m.Lockouts,
+		m.ConsentDecisions,
+		m.RateLimited,
+		m.RevocationsDropped,
+		users,
+	)
+
+	return m
+}
+
+// Handler serves the metrics in the Prometheus text format
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.InstrumentMetricHandler(m.registry, promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{}))
+}
+
+// ObserveRequest records a request served by the chi router
+func (m *Metrics) ObserveRequest(r *http.Request, status int, d time.Duration) {
+	route := Route(r, status)
+
+	m.HTTPRequests.WithLabelValues(route, r.Method, strconv.Itoa(status)).Inc()
+	m.HTTPDuration.WithLabelValues(route, r.Method).Observe(d.Seconds())
+}
+
+// Route is the chi route pattern that matched the request. Routes handled
+// below a wildcard mount, such as the authboss routes, are reported by path
+// unless they were not found, to keep the number of label values bounded.
+func Route(r *http.Request, status int) string {
+	rctx := chi.RouteContext(r.Context())
+	if rctx == nil {
+		return "unmatched"
+	}
+
+	pattern := rctx.RoutePattern()
+	switch {
+	case pattern == "" || status == http.StatusNotFound:
+		return "unmatched"
+	case strings.HasSuffix(pattern, "/*"):
+		return r.URL.Path
+	}
+
+	return pattern
+}
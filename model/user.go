@@ -11,19 +11,21 @@ import (
 
 // User struct for authboss
 type User struct {
-	ID int
+	// ID is the opaque, stable identifier used as the OAuth2 subject
+	ID string
 
 	// Non-authboss related field
-	Name string
-	Role string
+	Name     string
+	Role     string
+	Disabled bool
 
 	// Auth
 	Email    string
-	Password string
+	Password string `log:"secret"`
 
 	// Confirm
-	ConfirmSelector string
-	ConfirmVerifier string
+	ConfirmSelector string `log:"secret"`
+	ConfirmVerifier string `log:"secret"`
 	Confirmed       bool
 
 	// Lock
@@ -32,26 +34,54 @@ type User struct {
 	Locked       time.Time
 
 	// Recover
-	RecoverSelector    string
-	RecoverVerifier    string
+	RecoverSelector    string `log:"secret"`
+	RecoverVerifier    string `log:"secret"`
 	RecoverTokenExpiry time.Time
 
 	// OAuth2
 	OAuth2UID          string
 	OAuth2Provider     string
-	OAuth2AccessToken  string
-	OAuth2RefreshToken string
+	OAuth2AccessToken  string `log:"secret"`
+	OAuth2RefreshToken string `log:"secret"`
 	OAuth2Expiry       time.Time
 
 	// 2fa
-	TOTPSecretKey      string
+	TOTPSecretKey      string `log:"secret"`
 	SMSPhoneNumber     string
 	SMSSeedPhoneNumber string
-	RecoveryCodes      string
+	RecoveryCodes      string `log:"secret"`
+
+	// Recent successful logins, most recent first
+	Logins []Login
 
 	// Remember is in another table
 }
 
+// MaxLogins is the number of logins kept in a user's history
+const MaxLogins = 10
+
+// Login records a successful authentication
+type Login struct {
+	Time      time.Time
+	IP        string
+	UserAgent string
+	Methods   []string
+}
+
+// AddLogin records a login, forgetting the oldest beyond MaxLogins
+func (u *User) AddLogin(l Login) {
+	u.Logins = append([]Login{l}, u.Logins...)
+	if len(u.Logins) > MaxLogins {
+		u.Logins = u.Logins[:MaxLogins]
+	}
+}
+
+// SubjectUser has a stable identifier to use as the OAuth2 subject
+type SubjectUser interface {
+	GetSubject() string
+	PutSubject(id string)
+}
+
 // This pattern is useful in real code to ensure that
 // we've got the right interfaces implemented.
 var (
@@ -66,8 +96,13 @@ var (
 
 	_ totp2fa.User = assertUser
 	_ sms2fa.User  = assertUser
+
+	_ SubjectUser = assertUser
 )
 
+// PutSubject into user
+func (u *User) PutSubject(id string) { u.ID = id }
+
 // PutPID into user
 func (u *User) PutPID(pid string) { u.Email = pid }
 
@@ -204,6 +239,12 @@ func (u User) GetOAuth2RefreshToken() (refreshToken string) { return u.OAuth2Ref
 // GetOAuth2Expiry from user
 func (u User) GetOAuth2Expiry() (expiry time.Time) { return u.OAuth2Expiry }
 
+// GetSubject returns the identifier sent to Hydra as the subject
+func (u User) GetSubject() string { return u.ID }
+
+// IsDisabled reports whether the user has been disabled by an administrator
+func (u User) IsDisabled() bool { return u.Disabled }
+
 // GetArbitrary from user
 func (u User) GetArbitrary() map[string]string {
 	return map[string]string{
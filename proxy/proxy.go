@@ -0,0 +1,240 @@
+// Package proxy finds the client of requests that reach the service through
+// trusted reverse proxies.
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Trusted lists the networks of the reverse proxies whose forwarding headers
+// are believed. The zero value trusts no one.
+type Trusted []*net.IPNet
+
+// ParseTrusted parses a comma separated list of IP addresses and CIDR
+// networks, such as 10.0.0.0/8,192.168.1.1
+func ParseTrusted(s string) (Trusted, error) {
+	var t Trusted
+	for _, entry := range strings.Split(s, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("%q is not an IP address or network", entry)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			t = append(t, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not an IP address or network", entry)
+		}
+		t = append(t, network)
+	}
+
+	return t, nil
+}
+
+// Contains reports whether ip belongs to a trusted proxy
+func (t Trusted) Contains(ip net.IP) bool {
+	for _, network := range t {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Client is where a request came from
+type Client struct {
+	// IP is the address of the client
+	IP string
+	// Scheme is http or https, as used by the client
+	Scheme string
+}
+
+// hop is a client of a proxy, as the proxy reported it
+type hop struct {
+	ip    string
+	proto string
+}
+
+// Client finds the client of the request. When the request comes from a
+// trusted proxy, the Forwarded header, or X-Forwarded-For and
+// X-Forwarded-Proto when it is absent, are walked from the right past the
+// trusted proxies. The first address not trusted is the client, so a
+// client cannot forge its address by sending the headers itself.
+func (t Trusted) Client(r *http.Request) Client {
+	c := Client{IP: remoteIP(r), Scheme: "http"}
+	if r.TLS != nil {
+		c.Scheme = "https"
+	}
+
+	if !t.Contains(net.ParseIP(c.IP)) {
+		return c
+	}
+
+	hops := forwarded(r)
+	if hops == nil {
+		hops = xForwarded(r)
+	}
+
+	for i := len(hops) - 1; i >= 0; i-- {
+		if net.ParseIP(hops[i].ip) == nil {
+			break
+		}
+
+		// The scheme of a hop carries over to the hops before it that do not
+		// report their own
+		c.IP = hops[i].ip
+		if hops[i].proto == "http" || hops[i].proto == "https" {
+			c.Scheme = hops[i].proto
+		}
+		if !t.Contains(net.ParseIP(c.IP)) {
+			break
+		}
+	}
+
+	return c
+}
+
+// forwarded parses the Forwarded header of RFC 7239, or returns nil if
+// there is none
+func forwarded(r *http.Request) []hop {
+	values := r.Header["Forwarded"]
+	if len(values) == 0 {
+		return nil
+	}
+
+	var hops []hop
+	for _, element := range strings.Split(strings.Join(values, ","), ",") {
+		var h hop
+		for _, pair := range strings.Split(element, ";") {
+			kv := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			value := strings.Trim(kv[1], `"`)
+
+			switch strings.ToLower(kv[0]) {
+			case "for":
+				h.ip = forwardedIP(value)
+			case "proto":
+				h.proto = strings.ToLower(value)
+			}
+		}
+		hops = append(hops, h)
+	}
+
+	return hops
+}
+
+// forwardedIP strips the port from a node of the Forwarded header, such as
+// 192.0.2.43:47011 or [2001:db8:cafe::17]:4711
+func forwardedIP(node string) string {
+	if strings.HasPrefix(node, "[") {
+		if end := strings.Index(node, "]"); end > 0 {
+			return node[1:end]
+		}
+		return ""
+	}
+
+	if host, _, err := net.SplitHostPort(node); err == nil {
+		return host
+	}
+
+	return node
+}
+
+// xForwarded pairs the addresses of X-Forwarded-For with the schemes of
+// X-Forwarded-Proto. Proxies that set the scheme rather than appending to it
+// leave a single value, which is the scheme the nearest proxy was reached
+// with.
+func xForwarded(r *http.Request) []hop {
+	ips := splitList(r.Header["X-Forwarded-For"])
+	protos := splitList(r.Header["X-Forwarded-Proto"])
+
+	hops := make([]hop, len(ips))
+	for i, ip := range ips {
+		hops[i].ip = ip
+	}
+
+	switch {
+	case len(protos) == len(ips):
+		for i, proto := range protos {
+			hops[i].proto = strings.ToLower(proto)
+		}
+	case len(protos) > 0 && len(ips) > 0:
+		hops[len(hops)-1].proto = strings.ToLower(protos[len(protos)-1])
+	}
+
+	return hops
+}
+
+func splitList(values []string) []string {
+	var out []string
+	for _, v := range strings.Split(strings.Join(values, ","), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+
+	return out
+}
+
+// remoteIP is the address of the peer, without the port
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+type contextKey struct{}
+
+// Middleware finds the client of every request and stores it on the
+// context for ClientIP and Scheme
+func (t Trusted) Middleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c := t.Client(r)
+		h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), contextKey{}, c)))
+	})
+}
+
+// ClientIP is the address of the client found by Middleware, or the peer
+// address of requests it did not handle
+func ClientIP(r *http.Request) string {
+	if c, ok := r.Context().Value(contextKey{}).(Client); ok {
+		return c.IP
+	}
+
+	return remoteIP(r)
+}
+
+// Scheme is the scheme used by the client found by Middleware, or the one
+// the request was received with if it did not handle it
+func Scheme(r *http.Request) string {
+	if c, ok := r.Context().Value(contextKey{}).(Client); ok {
+		return c.Scheme
+	}
+	if r.TLS != nil {
+		return "https"
+	}
+
+	return "http"
+}
@@ -0,0 +1,236 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseTrusted(t *testing.T) {
+	trusted, err := ParseTrusted(" 10.0.0.0/8, 192.168.1.1,2001:db8::1 ,,fd00::/8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(trusted); got != 4 {
+		t.Fatalf("parsed %d networks, want 4", got)
+	}
+
+	for ip, want := range map[string]bool{
+		"10.1.2.3":    true,
+		"192.168.1.1": true,
+		"192.168.1.2": false,
+		"2001:db8::1": true,
+		"2001:db8::2": false,
+		"fd00::17":    true,
+		"11.0.0.1":    false,
+	} {
+		if got := trusted.Contains(net.ParseIP(ip)); got != want {
+			t.Errorf("Contains(%s) = %v, want %v", ip, got, want)
+		}
+	}
+
+	for _, s := range []string{"10.0.0.0/33", "10.0.0", "proxy.local"} {
+		if _, err := ParseTrusted(s); err == nil {
+			t.Errorf("ParseTrusted(%q) succeeded", s)
+		}
+	}
+}
+
+func TestClient(t *testing.T) {
+	trusted, err := ParseTrusted("10.0.0.0/8,2001:db8::/32")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		remote string
+		tls    bool
+		header http.Header
+		want   Client
+	}{
+		{
+			name:   "no proxy",
+			remote: "203.0.113.7:4000",
+			want:   Client{IP: "203.0.113.7", Scheme: "http"},
+		},
+		{
+			name:   "tls",
+			remote: "203.0.113.7:4000",
+			tls:    true,
+			want:   Client{IP: "203.0.113.7", Scheme: "https"},
+		},
+		{
+			name:   "headers from an untrusted peer",
+			remote: "203.0.113.7:4000",
+			header: http.Header{
+				"X-Forwarded-For":   {"198.51.100.1"},
+				"X-Forwarded-Proto": {"https"},
+				"Forwarded":         {"for=198.51.100.1;proto=https"},
+			},
+			want: Client{IP: "203.0.113.7", Scheme: "http"},
+		},
+		{
+			name:   "x-forwarded-for",
+			remote: "10.0.0.1:4000",
+			header: http.Header{"X-Forwarded-For": {"198.51.100.1"}, "X-Forwarded-Proto": {"https"}},
+			want:   Client{IP: "198.51.100.1", Scheme: "https"},
+		},
+		{
+			name:   "rightmost untrusted hop",
+			remote: "10.0.0.1:4000",
+			header: http.Header{"X-Forwarded-For": {"198.51.100.1, 203.0.113.7, 10.0.0.2", "10.0.0.3"}},
+			want:   Client{IP: "203.0.113.7", Scheme: "http"},
+		},
+		{
+			name:   "spoofed leftmost entries",
+			remote: "10.0.0.1:4000",
+			header: http.Header{"X-Forwarded-For": {"10.0.0.9, 127.0.0.1, 203.0.113.7"}},
+			want:   Client{IP: "203.0.113.7", Scheme: "http"},
+		},
+		{
+			name:   "only trusted hops",
+			remote: "10.0.0.1:4000",
+			header: http.Header{"X-Forwarded-For": {"10.0.0.3, 10.0.0.2"}},
+			want:   Client{IP: "10.0.0.3", Scheme: "http"},
+		},
+		{
+			name:   "scheme of each hop",
+			remote: "10.0.0.1:4000",
+			header: http.Header{
+				"X-Forwarded-For":   {"203.0.113.7, 10.0.0.2"},
+				"X-Forwarded-Proto": {"https, http"},
+			},
+			want: Client{IP: "203.0.113.7", Scheme: "https"},
+		},
+		{
+			name:   "scheme set by the nearest proxy",
+			remote: "10.0.0.1:4000",
+			header: http.Header{
+				"X-Forwarded-For":   {"203.0.113.7, 10.0.0.2"},
+				"X-Forwarded-Proto": {"https"},
+			},
+			want: Client{IP: "203.0.113.7", Scheme: "https"},
+		},
+		{
+			name:   "forwarded takes precedence",
+			remote: "10.0.0.1:4000",
+			header: http.Header{
+				"Forwarded":       {"for=192.0.2.60;proto=https;by=203.0.113.43"},
+				"X-Forwarded-For": {"198.51.100.1"},
+			},
+			want: Client{IP: "192.0.2.60", Scheme: "https"},
+		},
+		{
+			name:   "forwarded with several hops",
+			remote: "10.0.0.1:4000",
+			header: http.Header{"Forwarded": {"for=198.51.100.1, for=192.0.2.60:47011", "for=10.0.0.2;proto=https"}},
+			want:   Client{IP: "192.0.2.60", Scheme: "https"},
+		},
+		{
+			name:   "forwarded with a quoted ipv6 address",
+			remote: "[2001:db8::1]:4000",
+			header: http.Header{"Forwarded": {`For="[2001:db8:cafe::17]:4711";Proto=HTTPS`}},
+			want:   Client{IP: "2001:db8:cafe::17", Scheme: "https"},
+		},
+		{
+			name:   "forwarded with a quoted ipv4 address",
+			remote: "10.0.0.1:4000",
+			header: http.Header{"Forwarded": {`for="192.0.2.60"`}},
+			want:   Client{IP: "192.0.2.60", Scheme: "http"},
+		},
+		{
+			name:   "forwarded with an unterminated ipv6 address",
+			remote: "10.0.0.1:4000",
+			header: http.Header{"Forwarded": {`for="[2001:db8:cafe::17";proto=https`}},
+			want:   Client{IP: "10.0.0.1", Scheme: "http"},
+		},
+		{
+			name:   "forwarded with an unquoted ipv6 address",
+			remote: "10.0.0.1:4000",
+			header: http.Header{"Forwarded": {"for=2001:db8:cafe::17"}},
+			want:   Client{IP: "2001:db8:cafe::17", Scheme: "http"},
+		},
+		{
+			name:   "forwarded with an obfuscated node",
+			remote: "10.0.0.1:4000",
+			header: http.Header{"Forwarded": {"for=198.51.100.1, for=_hidden, for=10.0.0.2"}},
+			want:   Client{IP: "10.0.0.2", Scheme: "http"},
+		},
+		{
+			name:   "forwarded without for",
+			remote: "10.0.0.1:4000",
+			header: http.Header{"Forwarded": {"proto=https;by=10.0.0.1, garbage"}},
+			want:   Client{IP: "10.0.0.1", Scheme: "http"},
+		},
+		{
+			name:   "proto of a spoofed hop",
+			remote: "10.0.0.1:4000",
+			tls:    true,
+			header: http.Header{"Forwarded": {"for=198.51.100.1;proto=http, for=203.0.113.7;proto=https"}},
+			want:   Client{IP: "203.0.113.7", Scheme: "https"},
+		},
+		{
+			name:   "proto of a spoofed x-forwarded-for hop",
+			remote: "10.0.0.1:4000",
+			header: http.Header{
+				"X-Forwarded-For":   {"198.51.100.1, 203.0.113.7"},
+				"X-Forwarded-Proto": {"https, http"},
+			},
+			want: Client{IP: "203.0.113.7", Scheme: "http"},
+		},
+		{
+			name:   "unknown proto",
+			remote: "10.0.0.1:4000",
+			tls:    true,
+			header: http.Header{"Forwarded": {"for=203.0.113.7;proto=gopher"}},
+			want:   Client{IP: "203.0.113.7", Scheme: "https"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remote
+			if tt.tls {
+				r.TLS = &tls.ConnectionState{}
+			}
+			for k, v := range tt.header {
+				r.Header[http.CanonicalHeaderKey(k)] = v
+			}
+
+			if got := trusted.Client(r); got != tt.want {
+				t.Errorf("Client() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	trusted, err := ParseTrusted("10.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ip, scheme string
+	h := trusted.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip, scheme = ClientIP(r), Scheme(r)
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "10.0.0.1:4000"
+	r.Header.Set("X-Forwarded-For", "203.0.113.7")
+	r.Header.Set("X-Forwarded-Proto", "https")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	if ip != "203.0.113.7" || scheme != "https" {
+		t.Errorf("got client %s over %s, want 203.0.113.7 over https", ip, scheme)
+	}
+
+	// Without the middleware the peer is the client
+	if got := ClientIP(r); got != "10.0.0.1" {
+		t.Errorf("ClientIP() = %s without the middleware, want 10.0.0.1", got)
+	}
+}
@@ -0,0 +1,130 @@
+// Package ratelimit throttles events per key, such as login attempts per
+// client IP, with token buckets.
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often buckets that have filled up again are dropped
+const sweepInterval = time.Minute
+
+// Rate is a number of events allowed per period. Bursts of up to Events are
+// allowed, after which events are spread over the period. The zero Rate
+// allows everything.
+type Rate struct {
+	Events int
+	Per    time.Duration
+}
+
+// ParseRate parses a rate such as 10/1m, ten events per minute. "off" and
+// the empty string mean no limit.
+func ParseRate(s string) (Rate, error) {
+	if s == "" || s == "off" {
+		return Rate{}, nil
+	}
+
+	parts := strings.SplitN(s, "/", 2)
+	if len(parts) != 2 {
+		return Rate{}, fmt.Errorf("must be events per period, such as 10/1m, not %q", s)
+	}
+
+	events, err := strconv.Atoi(parts[0])
+	if err != nil || events < 1 {
+		return Rate{}, fmt.Errorf("must allow a positive number of events, not %q", parts[0])
+	}
+
+	per, err := time.ParseDuration(parts[1])
+	if err != nil || per <= 0 {
+		return Rate{}, fmt.Errorf("must have a positive period, not %q", parts[1])
+	}
+
+	return Rate{Events: events, Per: per}, nil
+}
+
+func (r Rate) String() string {
+	if r.Events == 0 {
+		return "off"
+	}
+
+	return fmt.Sprintf("%d/%s", r.Events, r.Per)
+}
+
+// Limiter keeps a token bucket per key. A nil Limiter allows everything.
+type Limiter struct {
+	rate Rate
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewLimiter creates a Limiter allowing rate per key, or nil for the zero
+// Rate
+func NewLimiter(rate Rate) *Limiter {
+	if rate.Events == 0 {
+		return nil
+	}
+
+	return &Limiter{rate: rate, buckets: map[string]*bucket{}}
+}
+
+// Allow takes a token from the bucket of key. When the bucket is empty it
+// reports how long until the next token.
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	if l == nil {
+		return true, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(l.rate.Events), last: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = math.Min(float64(l.rate.Events), b.tokens+now.Sub(b.last).Seconds()*l.perSecond())
+	b.last = now
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / l.perSecond() * float64(time.Second))
+		return false, wait
+	}
+
+	b.tokens--
+	return true, 0
+}
+
+func (l *Limiter) perSecond() float64 {
+	return float64(l.rate.Events) / l.rate.Per.Seconds()
+}
+
+// sweep drops the buckets that have filled up again, which are the same as
+// no bucket at all
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = now
+
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.perSecond() >= float64(l.rate.Events) {
+			delete(l.buckets, key)
+		}
+	}
+}
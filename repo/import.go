@@ -3,47 +3,147 @@ package repo
 import (
 	"context"
 	"encoding/json"
-	"log"
+	"fmt"
 	"os"
 
+	"github.com/google/uuid"
+	"github.com/nbycomp/login-consent/model"
 	"github.com/volatiletech/authboss"
 )
 
+// subjectNamespace is used to derive subject identifiers for imported users
+// that don't have one, so they stay the same across restarts
+var subjectNamespace = uuid.MustParse("0b6e0a36-5f39-4b1c-9d7e-7c2a64b1e1d4")
+
 type ImportedUser struct {
+	ID       string `json:"id"`
 	Name     string `json:"name"`
 	Email    string `json:"email"`
 	Password string `json:"password"`
 	Role     string `json:"role"`
+	Disabled bool   `json:"disabled"`
+}
+
+// Import parses users from a JSON file and inserts them into the DB. The
+// store logs to the logger on ctx.
+func Import(ctx context.Context, filename string, db authboss.CreatingServerStorer) error {
+	users, err := readUsers(filename)
+	if err != nil {
+		return err
+	}
+
+	for _, u := range users {
+		user := authboss.MustBeAuthable(db.New(ctx))
+		u.apply(user)
+
+		if err := db.Create(ctx, user); err != nil {
+			return fmt.Errorf("%s: %v", u.Email, err)
+		}
+	}
+
+	return nil
+}
+
+// Sync brings the DB in line with the users in a JSON file: new users are
+// created, existing ones updated, and password users missing from the file
+// are deleted so their access is revoked. The password and name of existing
+// users are left alone, as users change those themselves.
+func Sync(ctx context.Context, filename string, db *MemStorer) error {
+	users, err := readUsers(filename)
+	if err != nil {
+		return err
+	}
+
+	inFile := map[string]bool{}
+	for _, u := range users {
+		inFile[u.Email] = true
+
+		existing, err := db.Load(ctx, u.Email)
+		if err == authboss.ErrUserNotFound {
+			user := db.New(ctx).(*model.User)
+			u.apply(user)
+			if err := db.Create(ctx, user); err != nil {
+				return err
+			}
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		user := existing.(*model.User)
+		u.update(user)
+		if err := db.Save(ctx, user); err != nil {
+			return err
+		}
+	}
+
+	db.mu.RLock()
+	var removed []string
+	for email, u := range db.Users {
+		if !inFile[email] && !u.IsOAuth2User() {
+			removed = append(removed, email)
+		}
+	}
+	db.mu.RUnlock()
+
+	for _, email := range removed {
+		if err := db.Delete(ctx, email); err != nil && err != authboss.ErrUserNotFound {
+			return err
+		}
+	}
+
+	return nil
 }
 
-// Import parses users from a JSON file and inserts them into the DB
-func Import(filename string, db authboss.CreatingServerStorer) {
+func readUsers(filename string) ([]ImportedUser, error) {
 	f, err := os.Open(filename)
 	if err != nil {
-		log.Fatalf("failed to import users from file %s\n", filename)
+		return nil, err
 	}
 	defer f.Close()
 
 	var users []ImportedUser
 	d := json.NewDecoder(f)
-	err = d.Decode(&users)
-	if err != nil {
-		log.Fatalf("failed to parse users: %v\n", err)
+	if err := d.Decode(&users); err != nil {
+		return nil, err
 	}
 
-	for _, u := range users {
-		user := authboss.MustBeAuthable(db.New(context.Background()))
+	return users, nil
+}
 
-		user.PutPID(u.Email)
-		user.PutPassword(u.Password)
+// apply copies the imported fields onto user. A user that already has a
+// subject identifier keeps it unless the file sets one.
+func (u ImportedUser) apply(user authboss.AuthableUser) {
+	user.PutPID(u.Email)
+	user.PutPassword(u.Password)
+
+	if arbUser, ok := user.(authboss.ArbitraryUser); ok {
+		arbUser.PutArbitrary(map[string]string{
+			"name": u.Name,
+			"role": u.Role,
+		})
+	}
 
-		if arbUser, ok := user.(authboss.ArbitraryUser); ok {
-			arbUser.PutArbitrary(map[string]string{
-				"name": u.Name,
-				"role": u.Role,
-			})
+	if subUser, ok := user.(model.SubjectUser); ok {
+		switch {
+		case u.ID != "":
+			subUser.PutSubject(u.ID)
+		case subUser.GetSubject() == "":
+			subUser.PutSubject(uuid.NewSHA1(subjectNamespace, []byte(u.Email)).String())
 		}
+	}
+
+	if mUser, ok := user.(*model.User); ok {
+		mUser.Disabled = u.Disabled
+	}
+}
 
-		db.Create(context.Background(), user)
+// update copies the fields that only the file sets onto an existing user:
+// the role, the subject identifier and whether the user is disabled
+func (u ImportedUser) update(user *model.User) {
+	user.Role = u.Role
+	if u.ID != "" {
+		user.ID = u.ID
 	}
+	user.Disabled = u.Disabled
 }
@@ -0,0 +1,98 @@
+package repo
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/nbycomp/login-consent/model"
+)
+
+func writeUsers(t *testing.T, users string) string {
+	t.Helper()
+
+	f, err := ioutil.TempFile("", "users-*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if _, err := f.WriteString(users); err != nil {
+		t.Fatal(err)
+	}
+
+	return f.Name()
+}
+
+func loadUser(t *testing.T, db *MemStorer, email string) *model.User {
+	t.Helper()
+
+	u, err := db.Load(context.Background(), email)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return u.(*model.User)
+}
+
+func TestSyncKeepsWhatUsersChanged(t *testing.T) {
+	db := NewMemStorer()
+
+	before := writeUsers(t, `[{"id": "s1", "name": "Rick", "email": "rick@example.com", "password": "hash1", "role": "user"}]`)
+	defer os.Remove(before)
+	if err := Import(context.Background(), before, db); err != nil {
+		t.Fatal(err)
+	}
+
+	user := loadUser(t, db, "rick@example.com")
+	user.Name, user.Password = "Rick Sanchez", "hash2"
+	if err := db.Save(context.Background(), user); err != nil {
+		t.Fatal(err)
+	}
+
+	after := writeUsers(t, `[
+		{"id": "s2", "name": "Rick", "email": "rick@example.com", "password": "hash1", "role": "admin", "disabled": true},
+		{"name": "Morty", "email": "morty@example.com", "password": "hash3", "role": "user"}
+	]`)
+	defer os.Remove(after)
+	if err := Sync(context.Background(), after, db); err != nil {
+		t.Fatal(err)
+	}
+
+	user = loadUser(t, db, "rick@example.com")
+	if user.Name != "Rick Sanchez" || user.Password != "hash2" {
+		t.Errorf("got name %q and password %q, want the ones the user set", user.Name, user.Password)
+	}
+	if user.Role != "admin" || user.ID != "s2" || !user.Disabled {
+		t.Errorf("got role %q, id %q and disabled %v, want those of the file", user.Role, user.ID, user.Disabled)
+	}
+
+	created := loadUser(t, db, "morty@example.com")
+	if created.Name != "Morty" || created.Password != "hash3" || created.Role != "user" || created.ID == "" {
+		t.Errorf("new user %+v does not have the fields of the file", created)
+	}
+}
+
+func TestSyncDeletesUsersMissingFromTheFile(t *testing.T) {
+	db := NewMemStorer()
+
+	before := writeUsers(t, `[{"email": "rick@example.com", "password": "hash1"}, {"email": "morty@example.com", "password": "hash2"}]`)
+	defer os.Remove(before)
+	if err := Import(context.Background(), before, db); err != nil {
+		t.Fatal(err)
+	}
+
+	after := writeUsers(t, `[{"email": "rick@example.com", "password": "hash1"}]`)
+	defer os.Remove(after)
+	if err := Sync(context.Background(), after, db); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db.Load(context.Background(), "morty@example.com"); err == nil {
+		t.Error("the user missing from the file was not deleted")
+	}
+	if db.Count() != 1 {
+		t.Errorf("got %d users, want 1", db.Count())
+	}
+}
@@ -2,9 +2,10 @@ package repo
 
 import (
 	"context"
-	"fmt"
+	"sync"
 
-	"github.com/davecgh/go-spew/spew"
+	"github.com/google/uuid"
+	"github.com/nbycomp/login-consent/logging"
 	"github.com/nbycomp/login-consent/model"
 	"github.com/pkg/errors"
 	"github.com/volatiletech/authboss"
@@ -20,10 +21,21 @@ var (
 	_ authboss.RememberingServerStorer = assertStorer
 )
 
+// Revoker cuts off the access of users that were disabled or deleted
+type Revoker interface {
+	Revoke(subject string, clientIDs ...string)
+}
+
 // MemStorer stores users in memory
 type MemStorer struct {
 	Users  map[string]model.User
 	Tokens map[string][]string
+
+	// Revoker, if set, is told about users that are disabled or deleted, or
+	// whose subject identifier changes
+	Revoker Revoker
+
+	mu *sync.RWMutex
 }
 
 // NewMemStorer constructor
@@ -31,26 +43,76 @@ func NewMemStorer() *MemStorer {
 	return &MemStorer{
 		Users:  map[string]model.User{},
 		Tokens: make(map[string][]string),
+		mu:     &sync.RWMutex{},
 	}
 }
 
 // Save the user
 func (m MemStorer) Save(ctx context.Context, user authboss.User) error {
 	u := user.(*model.User)
+
+	m.mu.Lock()
+	old, existed := m.Users[u.Email]
 	m.Users[u.Email] = *u
+	m.mu.Unlock()
+
+	// The sessions Hydra holds are those of the subject before the save
+	if existed && (old.ID != u.ID || (!old.Disabled && u.Disabled)) {
+		m.revoke(old.ID)
+	}
+
+	logging.FromContext(ctx).Debug("saved user", "pid", u.Email)
+	return nil
+}
+
+// Delete the user with the given pid along with their remember tokens
+func (m MemStorer) Delete(ctx context.Context, pid string) error {
+	m.mu.Lock()
+	u, ok := m.Users[pid]
+	if !ok {
+		m.mu.Unlock()
+		return authboss.ErrUserNotFound
+	}
+	delete(m.Users, pid)
+	delete(m.Tokens, pid)
+	m.mu.Unlock()
 
-	fmt.Println("Saved user:", u.Name)
+	m.revoke(u.ID)
+
+	logging.FromContext(ctx).Info("deleted user", "pid", u.Email)
 	return nil
 }
 
+// SetDisabled disables or re-enables the user with the given pid
+func (m MemStorer) SetDisabled(ctx context.Context, pid string, disabled bool) error {
+	m.mu.RLock()
+	u, ok := m.Users[pid]
+	m.mu.RUnlock()
+	if !ok {
+		return authboss.ErrUserNotFound
+	}
+
+	u.Disabled = disabled
+	return m.Save(ctx, &u)
+}
+
+func (m MemStorer) revoke(subject string) {
+	if m.Revoker != nil && subject != "" {
+		m.Revoker.Revoke(subject)
+	}
+}
+
 // Load the user
 func (m MemStorer) Load(ctx context.Context, key string) (user authboss.User, err error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
 	// Check to see if our key is actually an oauth2 pid
 	provider, uid, err := authboss.ParseOAuth2PID(key)
 	if err == nil {
 		for _, u := range m.Users {
 			if u.OAuth2Provider == provider && u.OAuth2UID == uid {
-				fmt.Println("Loaded OAuth2 user:", u.Email)
+				logging.FromContext(ctx).Debug("loaded oauth2 user", "pid", u.Email)
 				return &u, nil
 			}
 		}
@@ -63,10 +125,55 @@ func (m MemStorer) Load(ctx context.Context, key string) (user authboss.User, er
 		return nil, authboss.ErrUserNotFound
 	}
 
-	fmt.Println("Loaded user:", u.Name)
+	logging.FromContext(ctx).Debug("loaded user", "pid", u.Email)
 	return &u, nil
 }
 
+// LoadBySubject looks a user up by the subject identifier sent to Hydra
+func (m MemStorer) LoadBySubject(ctx context.Context, subject string) (authboss.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, u := range m.Users {
+		if u.ID == subject {
+			logging.FromContext(ctx).Debug("loaded user by subject", "subject", subject, "pid", u.Email)
+			return &u, nil
+		}
+	}
+
+	return nil, authboss.ErrUserNotFound
+}
+
+// Ping reports whether the store can be used
+func (m MemStorer) Ping(ctx context.Context) error {
+	if m.Users == nil || m.mu == nil {
+		return errors.New("user store is not initialized")
+	}
+
+	return nil
+}
+
+// Count returns the number of users
+func (m MemStorer) Count() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return len(m.Users)
+}
+
+// Snapshot returns a copy of every user, to read while the store changes
+func (m MemStorer) Snapshot() []model.User {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	users := make([]model.User, 0, len(m.Users))
+	for _, u := range m.Users {
+		users = append(users, u)
+	}
+
+	return users
+}
+
 // New user creation
 func (m MemStorer) New(ctx context.Context) authboss.User {
 	return &model.User{}
@@ -74,22 +181,32 @@ func (m MemStorer) New(ctx context.Context) authboss.User {
 
 // Create the user
 func (m MemStorer) Create(ctx context.Context, user authboss.User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	u := user.(*model.User)
 
 	if _, ok := m.Users[u.Email]; ok {
 		return authboss.ErrUserFound
 	}
 
-	fmt.Println("Created new user:", u.Name)
+	if u.ID == "" {
+		u.ID = uuid.New().String()
+	}
+
+	logging.FromContext(ctx).Info("created user", "pid", u.Email)
 	m.Users[u.Email] = *u
 	return nil
 }
 
 // LoadByConfirmSelector looks a user up by confirmation token
 func (m MemStorer) LoadByConfirmSelector(ctx context.Context, selector string) (user authboss.ConfirmableUser, err error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
 	for _, v := range m.Users {
 		if v.ConfirmSelector == selector {
-			fmt.Println("Loaded user by confirm selector:", selector, v.Name)
+			logging.FromContext(ctx).Debug("loaded user by confirm selector", "pid", v.Email)
 			return &v, nil
 		}
 	}
@@ -99,9 +216,12 @@ func (m MemStorer) LoadByConfirmSelector(ctx context.Context, selector string) (
 
 // LoadByRecoverSelector looks a user up by confirmation selector
 func (m MemStorer) LoadByRecoverSelector(ctx context.Context, selector string) (user authboss.RecoverableUser, err error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
 	for _, v := range m.Users {
 		if v.RecoverSelector == selector {
-			fmt.Println("Loaded user by recover selector:", selector, v.Name)
+			logging.FromContext(ctx).Debug("loaded user by recover selector", "pid", v.Email)
 			return &v, nil
 		}
 	}
@@ -111,26 +231,33 @@ func (m MemStorer) LoadByRecoverSelector(ctx context.Context, selector string) (
 
 // AddRememberToken to a user
 func (m MemStorer) AddRememberToken(ctx context.Context, pid, token string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	m.Tokens[pid] = append(m.Tokens[pid], token)
-	fmt.Printf("Adding rm token to %s: %s\n", pid, token)
-	spew.Dump(m.Tokens)
+	logging.FromContext(ctx).Debug("added remember token", "pid", pid, "tokens", len(m.Tokens[pid]))
 	return nil
 }
 
 // DelRememberTokens removes all tokens for the given pid
 func (m MemStorer) DelRememberTokens(ctx context.Context, pid string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	delete(m.Tokens, pid)
-	fmt.Println("Deleting rm tokens from:", pid)
-	spew.Dump(m.Tokens)
+	logging.FromContext(ctx).Debug("deleted remember tokens", "pid", pid)
 	return nil
 }
 
 // UseRememberToken finds the pid-token pair and deletes it.
 // If the token could not be found return ErrTokenNotFound
 func (m MemStorer) UseRememberToken(ctx context.Context, pid, token string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	tokens, ok := m.Tokens[pid]
 	if !ok {
-		fmt.Println("Failed to find rm tokens for:", pid)
+		logging.FromContext(ctx).Debug("no remember tokens", "pid", pid)
 		return authboss.ErrTokenNotFound
 	}
 
@@ -138,7 +265,7 @@ func (m MemStorer) UseRememberToken(ctx context.Context, pid, token string) erro
 		if tok == token {
 			tokens[len(tokens)-1] = tokens[i]
 			m.Tokens[pid] = tokens[:len(tokens)-1]
-			fmt.Printf("Used remember for %s: %s\n", pid, token)
+			logging.FromContext(ctx).Debug("used remember token", "pid", pid)
 			return nil
 		}
 	}
@@ -148,6 +275,9 @@ func (m MemStorer) UseRememberToken(ctx context.Context, pid, token string) erro
 
 // NewFromOAuth2 creates an oauth2 user (but not in the database, just a blank one to be saved later)
 func (m MemStorer) NewFromOAuth2(ctx context.Context, provider string, details map[string]string) (authboss.OAuth2User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
 	switch provider {
 	case "google":
 		email := details[aboauth.OAuth2Email]
@@ -175,7 +305,13 @@ func (m MemStorer) NewFromOAuth2(ctx context.Context, provider string, details m
 
 // SaveOAuth2 user
 func (m MemStorer) SaveOAuth2(ctx context.Context, user authboss.OAuth2User) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	u := user.(*model.User)
+	if u.ID == "" {
+		u.ID = uuid.New().String()
+	}
 	m.Users[u.Email] = *u
 
 	return nil
@@ -0,0 +1,77 @@
+package repo
+
+import (
+	"context"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/nbycomp/login-consent/model"
+)
+
+// revoked records the subjects a MemStorer asks to revoke
+type revoked []string
+
+func (r *revoked) Revoke(subject string, clientIDs ...string) {
+	*r = append(*r, subject)
+}
+
+func TestSaveRevokesTheSubjectHydraKnows(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		change func(*model.User)
+		want   []string
+	}{
+		{"name change", func(u *model.User) { u.Name = "Rick Sanchez" }, nil},
+		{"disable", func(u *model.User) { u.Disabled = true }, []string{"s1"}},
+		{"id change", func(u *model.User) { u.ID = "s2" }, []string{"s1"}},
+		{"id change and disable", func(u *model.User) { u.ID, u.Disabled = "s2", true }, []string{"s1"}},
+	} {
+		db := NewMemStorer()
+		var got revoked
+		db.Revoker = &got
+
+		ctx := context.Background()
+		if err := db.Create(ctx, &model.User{ID: "s1", Email: "rick@example.com"}); err != nil {
+			t.Fatal(err)
+		}
+
+		user := loadUser(t, db, "rick@example.com")
+		test.change(user)
+		if err := db.Save(ctx, user); err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual([]string(got), test.want) {
+			t.Errorf("%s: revoked %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestSyncRevokesTheOldSubject(t *testing.T) {
+	for _, test := range []struct {
+		name, after string
+	}{
+		{"id change", `[{"id": "s2", "email": "rick@example.com", "password": "hash"}]`},
+		{"id change and disable", `[{"id": "s2", "email": "rick@example.com", "password": "hash", "disabled": true}]`},
+	} {
+		db := NewMemStorer()
+		var got revoked
+		db.Revoker = &got
+
+		before := writeUsers(t, `[{"id": "s1", "email": "rick@example.com", "password": "hash"}]`)
+		after := writeUsers(t, test.after)
+		if err := Import(context.Background(), before, db); err != nil {
+			t.Fatal(err)
+		}
+		if err := Sync(context.Background(), after, db); err != nil {
+			t.Fatal(err)
+		}
+		os.Remove(before)
+		os.Remove(after)
+
+		if !reflect.DeepEqual([]string(got), []string{"s1"}) {
+			t.Errorf("%s: revoked %v, want [s1]", test.name, got)
+		}
+	}
+}
@@ -0,0 +1,222 @@
+// Package secure sets the response headers that keep browsers from framing,
+// sniffing or loading more than the pages need: Content-Security-Policy,
+// Strict-Transport-Security, X-Frame-Options, Referrer-Policy and
+// X-Content-Type-Options.
+package secure
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Policy is a Content-Security-Policy, as sources per directive. The nonce
+// of the request is added to script-src and style-src when they are set.
+type Policy map[string][]string
+
+// DefaultPolicy allows the pages to load their own scripts, style sheets,
+// images and fonts, and inline scripts and styles only with the nonce. Pages
+// cannot be framed. form-action is left out because forms are redirected to
+// Hydra and on to the OAuth2 clients, which browsers check it against.
+func DefaultPolicy() Policy {
+	return Policy{
+		"default-src":     {"'none'"},
+		"script-src":      {"'self'"},
+		"style-src":       {"'self'"},
+		"img-src":         {"'self'"},
+		"font-src":        {"'self'"},
+		"connect-src":     {"'self'"},
+		"base-uri":        {"'none'"},
+		"frame-ancestors": {"'none'"},
+	}
+}
+
+// Copy returns a policy that can be changed without changing p
+func (p Policy) Copy() Policy {
+	out := make(Policy, len(p))
+	for directive, sources := range p {
+		out[directive] = append([]string(nil), sources...)
+	}
+
+	return out
+}
+
+// header renders the policy, with the directives sorted so the header is
+// the same on every response
+func (p Policy) header(nonce string) string {
+	directives := make([]string, 0, len(p))
+	for directive := range p {
+		directives = append(directives, directive)
+	}
+	sort.Strings(directives)
+
+	parts := make([]string, 0, len(p))
+	for _, directive := range directives {
+		sources := p[directive]
+		if nonce != "" && (directive == "script-src" || directive == "style-src") {
+			sources = append(sources[:len(sources):len(sources)], "'nonce-"+nonce+"'")
+		}
+		parts = append(parts, strings.TrimSpace(directive+" "+strings.Join(sources, " ")))
+	}
+
+	return strings.Join(parts, "; ")
+}
+
+// Options are the headers set on every response
+type Options struct {
+	// Policy is the Content-Security-Policy, DefaultPolicy when nil
+	Policy Policy
+	// HSTSMaxAge is how long browsers only reach the service over https,
+	// sent on https responses. Zero leaves Strict-Transport-Security out.
+	HSTSMaxAge time.Duration
+	// ReferrerPolicy is same-origin when empty
+	ReferrerPolicy string
+	// Scheme is how the client reached the service, the scheme the request
+	// was received with when nil
+	Scheme func(*http.Request) string
+}
+
+type contextKey struct{}
+
+// state is what Override needs to set the headers of a route again
+type state struct {
+	policy Policy
+	nonce  string
+}
+
+// Middleware sets the headers and generates the nonce of every request.
+// Routes change the policy with Override.
+func Middleware(opts Options) func(http.Handler) http.Handler {
+	policy := opts.Policy
+	if policy == nil {
+		policy = DefaultPolicy()
+	}
+	referrer := opts.ReferrerPolicy
+	if referrer == "" {
+		referrer = "same-origin"
+	}
+	scheme := opts.Scheme
+	if scheme == nil {
+		scheme = requestScheme
+	}
+	hsts := ""
+	if opts.HSTSMaxAge > 0 {
+		hsts = "max-age=" + strconv.FormatInt(int64(opts.HSTSMaxAge/time.Second), 10)
+	}
+
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			s := &state{policy: policy, nonce: newNonce()}
+
+			h := w.Header()
+			setPolicy(h, s)
+			h.Set("Referrer-Policy", referrer)
+			h.Set("X-Content-Type-Options", "nosniff")
+			if hsts != "" && scheme(r) == "https" {
+				h.Set("Strict-Transport-Security", hsts)
+			}
+
+			handler.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), contextKey{}, s)))
+		})
+	}
+}
+
+// Override changes the policy of the routes it is used on, after
+// Middleware. The policy given to change is a copy.
+func Override(change func(Policy)) func(http.Handler) http.Handler {
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			s, ok := r.Context().Value(contextKey{}).(*state)
+			if !ok {
+				handler.ServeHTTP(w, r)
+				return
+			}
+
+			s = &state{policy: s.policy.Copy(), nonce: s.nonce}
+			change(s.policy)
+			setPolicy(w.Header(), s)
+
+			handler.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), contextKey{}, s)))
+		})
+	}
+}
+
+// AllowFraming lets the pages be framed by the given sources, such as
+// https://app.example.com, for an embedded login. No sources keeps the
+// policy as it is.
+func AllowFraming(sources []string) func(Policy) {
+	return func(p Policy) {
+		if len(sources) > 0 {
+			p["frame-ancestors"] = sources
+		}
+	}
+}
+
+// setPolicy sets Content-Security-Policy and X-Frame-Options, which older
+// browsers read instead of frame-ancestors but cannot list sources in, so it
+// is only sent when nothing may frame the pages
+func setPolicy(h http.Header, s *state) {
+	h.Set("Content-Security-Policy", s.policy.header(s.nonce))
+
+	if ancestors := s.policy["frame-ancestors"]; len(ancestors) == 1 && ancestors[0] == "'none'" {
+		h.Set("X-Frame-Options", "DENY")
+	} else {
+		h.Del("X-Frame-Options")
+	}
+}
+
+// Nonce is the nonce of the request, which inline scripts and styles must
+// carry in a nonce attribute to run, or the empty string outside Middleware
+func Nonce(r *http.Request) string {
+	if s, ok := r.Context().Value(contextKey{}).(*state); ok {
+		return s.nonce
+	}
+
+	return ""
+}
+
+func newNonce() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+func requestScheme(r *http.Request) string {
+	if r.TLS != nil {
+		return "https"
+	}
+
+	return "http"
+}
+
+// ParseSources parses a space or comma separated list of frame-ancestors
+// sources: origins such as https://app.example.com, wildcards such as
+// https://*.example.com, and 'self'
+func ParseSources(s string) ([]string, error) {
+	var out []string
+	for _, source := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' }) {
+		if source == "'self'" {
+			out = append(out, source)
+			continue
+		}
+
+		u, err := url.Parse(strings.Replace(source, "*.", "wildcard.", 1))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" ||
+			(u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.Fragment != "" || u.User != nil {
+			return nil, fmt.Errorf("%q is not an origin such as https://app.example.com or 'self'", source)
+		}
+		out = append(out, strings.TrimSuffix(source, "/"))
+	}
+
+	return out, nil
+}
@@ -0,0 +1,201 @@
+package secure
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// serve runs a request through h and returns the response along with the
+// nonce the handler saw
+func serve(h func(http.Handler) http.Handler, r *http.Request) (*httptest.ResponseRecorder, string) {
+	var nonce string
+	rec := httptest.NewRecorder()
+	h(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nonce = Nonce(r)
+	})).ServeHTTP(rec, r)
+
+	return rec, nonce
+}
+
+func TestMiddleware(t *testing.T) {
+	rec, nonce := serve(Middleware(Options{}), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	want := map[string]string{
+		"Content-Security-Policy": "base-uri 'none'; connect-src 'self'; default-src 'none'; font-src 'self'; " +
+			"frame-ancestors 'none'; img-src 'self'; script-src 'self' 'nonce-" + nonce + "'; style-src 'self' 'nonce-" + nonce + "'",
+		"X-Frame-Options":           "DENY",
+		"Referrer-Policy":           "same-origin",
+		"X-Content-Type-Options":    "nosniff",
+		"Strict-Transport-Security": "",
+	}
+	for name, value := range want {
+		if got := rec.Header().Get(name); got != value {
+			t.Errorf("%s = %q, want %q", name, got, value)
+		}
+	}
+}
+
+func TestMiddlewareOptions(t *testing.T) {
+	mw := Middleware(Options{
+		Policy:         Policy{"default-src": {"'self'"}, "script-src": {"'self'", "https://cdn.example.com"}, "upgrade-insecure-requests": nil},
+		ReferrerPolicy: "no-referrer",
+	})
+	rec, nonce := serve(mw, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	want := "default-src 'self'; script-src 'self' https://cdn.example.com 'nonce-" + nonce + "'; upgrade-insecure-requests"
+	if got := rec.Header().Get("Content-Security-Policy"); got != want {
+		t.Errorf("Content-Security-Policy = %q, want %q", got, want)
+	}
+	if got := rec.Header().Get("X-Frame-Options"); got != "" {
+		t.Errorf("X-Frame-Options = %q without frame-ancestors 'none'", got)
+	}
+	if got := rec.Header().Get("Referrer-Policy"); got != "no-referrer" {
+		t.Errorf("Referrer-Policy = %q, want no-referrer", got)
+	}
+}
+
+func TestNonce(t *testing.T) {
+	mw := Middleware(Options{})
+	seen := map[string]bool{}
+
+	for i := 0; i < 100; i++ {
+		rec, nonce := serve(mw, httptest.NewRequest(http.MethodGet, "/", nil))
+
+		if b, err := base64.StdEncoding.DecodeString(nonce); err != nil || len(b) != 16 {
+			t.Fatalf("nonce %q is not 16 random bytes in base64", nonce)
+		}
+		if seen[nonce] {
+			t.Fatalf("nonce %q was used twice", nonce)
+		}
+		seen[nonce] = true
+
+		if want := "script-src 'self' 'nonce-" + nonce + "'"; !containsDirective(rec.Header().Get("Content-Security-Policy"), want) {
+			t.Fatalf("the policy %q does not allow the nonce of the request", rec.Header().Get("Content-Security-Policy"))
+		}
+	}
+
+	if got := Nonce(httptest.NewRequest(http.MethodGet, "/", nil)); got != "" {
+		t.Errorf("Nonce() = %q outside the middleware", got)
+	}
+}
+
+func TestHSTS(t *testing.T) {
+	https := func(*http.Request) string { return "https" }
+	insecure := func(*http.Request) string { return "http" }
+
+	tests := []struct {
+		name   string
+		maxAge time.Duration
+		scheme func(*http.Request) string
+		tls    bool
+		want   string
+	}{
+		{"tls", 365 * 24 * time.Hour, nil, true, "max-age=31536000"},
+		{"plain http", 365 * 24 * time.Hour, nil, false, ""},
+		{"disabled", 0, nil, true, ""},
+		{"https behind a proxy", time.Hour, https, false, "max-age=3600"},
+		{"http behind a proxy terminating tls", time.Hour, insecure, true, ""},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if tt.tls {
+			r.TLS = &tls.ConnectionState{}
+		}
+
+		rec, _ := serve(Middleware(Options{HSTSMaxAge: tt.maxAge, Scheme: tt.scheme}), r)
+		if got := rec.Header().Get("Strict-Transport-Security"); got != tt.want {
+			t.Errorf("%s: Strict-Transport-Security = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestOverride(t *testing.T) {
+	var nonce string
+	record := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		nonce = Nonce(r)
+	})
+
+	mux := http.NewServeMux()
+	mux.Handle("/login", Override(AllowFraming([]string{"https://app.example.com", "'self'"}))(record))
+	mux.Handle("/consent", Override(AllowFraming(nil))(record))
+	mux.Handle("/account", record)
+	h := Middleware(Options{})(mux)
+
+	tests := []struct {
+		path      string
+		ancestors string
+		frame     string
+	}{
+		{"/login", "frame-ancestors https://app.example.com 'self'", ""},
+		{"/consent", "frame-ancestors 'none'", "DENY"},
+		// The policy of other routes, and of later requests, is left alone
+		{"/account", "frame-ancestors 'none'", "DENY"},
+		{"/login", "frame-ancestors https://app.example.com 'self'", ""},
+	}
+
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+		csp := rec.Header().Get("Content-Security-Policy")
+		if !containsDirective(csp, tt.ancestors) {
+			t.Errorf("%s: Content-Security-Policy = %q, want %q", tt.path, csp, tt.ancestors)
+		}
+		if got := rec.Header().Get("X-Frame-Options"); got != tt.frame {
+			t.Errorf("%s: X-Frame-Options = %q, want %q", tt.path, got, tt.frame)
+		}
+		if want := "style-src 'self' 'nonce-" + nonce + "'"; !containsDirective(csp, want) {
+			t.Errorf("%s: the policy %q does not allow the nonce %q the route saw", tt.path, csp, nonce)
+		}
+	}
+}
+
+func TestParseSources(t *testing.T) {
+	got, err := ParseSources(" https://app.example.com,'self' https://*.example.com,, http://localhost:8080/ ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"https://app.example.com", "'self'", "https://*.example.com", "http://localhost:8080"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseSources() = %q, want %q", got, want)
+	}
+
+	if got, err := ParseSources(""); err != nil || got != nil {
+		t.Errorf("ParseSources(\"\") = %q, %v", got, err)
+	}
+
+	for _, s := range []string{
+		"app.example.com",
+		"'none'",
+		"*",
+		"ftp://app.example.com",
+		"https://",
+		"https://app.example.com/login",
+		"https://app.example.com?embed=1",
+		"https://app.example.com#top",
+		"https://user@app.example.com",
+	} {
+		if _, err := ParseSources(s); err == nil {
+			t.Errorf("ParseSources(%q) succeeded", s)
+		}
+	}
+}
+
+// containsDirective reports whether the policy has the directive with
+// exactly the given sources
+func containsDirective(policy, directive string) bool {
+	for _, d := range strings.Split(policy, "; ") {
+		if d == directive {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/nbycomp/login-consent/logging"
+	"github.com/nbycomp/login-consent/server"
+)
+
+// serve runs the servers until SIGTERM or SIGINT and waits for the requests
+// in flight to complete, then releases the audit log and app, logging to log.
+// It returns the exit code of the process.
+func serve(app *server.Server, log *logging.Logger, auditLog io.Closer, servers ...*http.Server) int {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGTERM, syscall.SIGINT)
+	defer signal.Stop(stop)
+
+	go func() {
+		select {
+		case sig := <-stop:
+			log.Info("received signal", "signal", sig.String())
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	exitCode := 0
+	if err := app.Serve(ctx, servers...); err != nil {
+		log.Error("failed to serve", "error", err)
+		exitCode = 1
+	}
+
+	if err := auditLog.Close(); err != nil {
+		log.Error("failed to close audit log", "error", err)
+		exitCode = 1
+	}
+
+	if err := app.Close(); err != nil {
+		log.Error("failed to close server", "error", err)
+		exitCode = 1
+	}
+
+	log.Info("stopped")
+	return exitCode
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/nbycomp/login-consent/config"
+	"github.com/nbycomp/login-consent/logging"
+	"github.com/nbycomp/login-consent/proxy"
+	"github.com/nbycomp/login-consent/ratelimit"
+	"github.com/nbycomp/login-consent/secure"
+)
+
+// settings are the values of the configuration that config keeps as text,
+// parsed by the packages that use them
+type settings struct {
+	logLevel       logging.Level
+	trusted        proxy.Trusted
+	ipRate         ratelimit.Rate
+	accountRate    ratelimit.Rate
+	frameAncestors []string
+}
+
+// Validate checks the settings config.Load leaves to the packages that
+// parse them, such as log_level, trusted_proxies and the rate limits,
+// reporting all the problems found at once
+func Validate(cfg config.Config) error {
+	_, err := parseSettings(cfg)
+	return err
+}
+
+func parseSettings(cfg config.Config) (settings, error) {
+	var s settings
+	var errs []string
+	invalid := func(name, format string, args ...interface{}) {
+		errs = append(errs, name+": "+fmt.Sprintf(format, args...))
+	}
+
+	var err error
+	if s.logLevel, err = logging.ParseLevel(cfg.LogLevel); err != nil {
+		invalid("log_level", "must be debug, info, warn or error, not %q", cfg.LogLevel)
+	}
+	if cfg.LogFormat != logging.FormatJSON && cfg.LogFormat != logging.FormatLogfmt {
+		invalid("log_format", "must be json or logfmt, not %q", cfg.LogFormat)
+	}
+
+	if s.trusted, err = proxy.ParseTrusted(cfg.TrustedProxies); err != nil {
+		invalid("trusted_proxies", "%v", err)
+	}
+	if s.ipRate, err = ratelimit.ParseRate(cfg.RateLimitIP); err != nil {
+		invalid("rate_limit_ip", "%v", err)
+	}
+	if s.accountRate, err = ratelimit.ParseRate(cfg.RateLimitAccount); err != nil {
+		invalid("rate_limit_account", "%v", err)
+	}
+
+	if s.frameAncestors, err = secure.ParseSources(cfg.FrameAncestors); err != nil {
+		invalid("frame_ancestors", "%v", err)
+	}
+
+	if len(errs) > 0 {
+		return s, errors.New("invalid configuration:\n  " + strings.Join(errs, "\n  "))
+	}
+
+	return s, nil
+}
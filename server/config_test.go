@@ -0,0 +1,45 @@
+package server
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nbycomp/login-consent/config"
+	"github.com/nbycomp/login-consent/logging"
+)
+
+func TestValidate(t *testing.T) {
+	cfg := config.Default()
+	cfg.LogLevel = "warn"
+	cfg.TrustedProxies = "10.0.0.0/8"
+	cfg.FrameAncestors = "https://app.example.com"
+
+	parsed, err := parseSettings(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.logLevel != logging.LevelWarn || len(parsed.trusted) != 1 || len(parsed.frameAncestors) != 1 {
+		t.Errorf("parsed %+v", parsed)
+	}
+
+	cfg.LogLevel = "verbose"
+	cfg.LogFormat = "text"
+	cfg.TrustedProxies = "proxy.local"
+	cfg.RateLimitIP = "often"
+	cfg.RateLimitAccount = "5/fortnight"
+	cfg.FrameAncestors = "app.example.com"
+
+	err = Validate(cfg)
+	if err == nil {
+		t.Fatal("the configuration is valid")
+	}
+	for _, name := range []string{"log_level", "log_format", "trusted_proxies", "rate_limit_ip", "rate_limit_account", "frame_ancestors"} {
+		if !strings.Contains(err.Error(), "\n  "+name+": ") {
+			t.Errorf("%s is not reported in %v", name, err)
+		}
+	}
+
+	if _, err := New(cfg); err == nil {
+		t.Error("New accepted the configuration")
+	}
+}
@@ -0,0 +1,95 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+	"github.com/volatiletech/authboss"
+	abclientstate "github.com/volatiletech/authboss-clientstate"
+
+	"github.com/nbycomp/login-consent/config"
+	"github.com/nbycomp/login-consent/logging"
+)
+
+// storeKeys returns the keys validated by config.Validate, generating a
+// random one if none are set
+func (s *Server) storeKeys(name string, keys []config.KeyPair) []config.KeyPair {
+	if len(keys) == 0 {
+		s.log.Warn("generating a random key, so users are logged out on restart; set a base64-encoded 64 byte key to keep them logged in", "setting", name)
+		return []config.KeyPair{{Hash: securecookie.GenerateRandomKey(64)}}
+	}
+
+	return keys
+}
+
+// keyPairs flattens keys into the hash and block key pairs gorilla expects
+func keyPairs(keys []config.KeyPair) [][]byte {
+	var pairs [][]byte
+	for _, k := range keys {
+		pairs = append(pairs, k.Hash, k.Block)
+	}
+
+	return pairs
+}
+
+// cookieStorer writes the remember me cookies with the current key, and
+// reads them with any key, so they survive a key rotation
+type cookieStorer struct {
+	storers []abclientstate.CookieStorer
+}
+
+func newCookieStorer(keys []config.KeyPair, secure bool) cookieStorer {
+	var c cookieStorer
+	for _, k := range keys {
+		storer := abclientstate.NewCookieStorer(k.Hash, k.Block)
+		storer.Secure = secure
+		c.storers = append(c.storers, storer)
+	}
+
+	return c
+}
+
+// ReadState decodes the cookies, preferring the keys listed first. Cookies
+// none of the keys can decode are ignored.
+func (c cookieStorer) ReadState(r *http.Request) (authboss.ClientState, error) {
+	state := abclientstate.CookieState{}
+	for i := len(c.storers) - 1; i >= 0; i-- {
+		cs, err := c.storers[i].ReadState(r)
+		if err != nil {
+			return nil, err
+		}
+
+		for k, v := range cs.(abclientstate.CookieState) {
+			state[k] = v
+		}
+	}
+
+	return state, nil
+}
+
+// WriteState encodes the cookies with the current key
+func (c cookieStorer) WriteState(w http.ResponseWriter, state authboss.ClientState, ev []authboss.ClientStateEvent) error {
+	return c.storers[0].WriteState(w, state, ev)
+}
+
+// sessionStore starts a new session, rather than failing the request, when
+// the session cookie was written with a key that has since been retired. The
+// cookies it cannot decode are logged at debug level.
+type sessionStore struct {
+	*sessions.CookieStore
+}
+
+func (s sessionStore) Get(r *http.Request, name string) (*sessions.Session, error) {
+	return sessions.GetRegistry(r).Get(s, name)
+}
+
+func (s sessionStore) New(r *http.Request, name string) (*sessions.Session, error) {
+	session, err := s.CookieStore.New(r, name)
+	if e, ok := err.(securecookie.Error); ok && e.IsDecode() {
+		logging.FromContext(r.Context()).Debug("starting a new session, none of the keys decode the session cookie", "cookie", name, "error", err)
+		return session, nil
+	}
+
+	return session, err
+}
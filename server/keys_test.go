@@ -0,0 +1,139 @@
+package server
+
+import (
+	"bytes"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/sessions"
+	"github.com/volatiletech/authboss"
+	abclientstate "github.com/volatiletech/authboss-clientstate"
+
+	"github.com/nbycomp/login-consent/config"
+	"github.com/nbycomp/login-consent/logging"
+)
+
+var (
+	oldKey = config.KeyPair{Hash: bytes.Repeat([]byte{1}, 64)}
+	newKey = config.KeyPair{Hash: bytes.Repeat([]byte{2}, 64)}
+	encKey = config.KeyPair{Hash: bytes.Repeat([]byte{3}, 64), Block: bytes.Repeat([]byte{4}, 32)}
+)
+
+// remember writes a remember me cookie with the keys and returns it
+func remember(t *testing.T, keys ...config.KeyPair) *http.Cookie {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	ev := []authboss.ClientStateEvent{{Kind: authboss.ClientStateEventPut, Key: authboss.CookieRemember, Value: "token"}}
+	if err := newCookieStorer(keys, false).WriteState(rec, abclientstate.CookieState{}, ev); err != nil {
+		t.Fatal(err)
+	}
+
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("wrote %d cookies, want 1", len(cookies))
+	}
+
+	return cookies[0]
+}
+
+// remembered reads the remember me token of the cookie with the keys
+func remembered(t *testing.T, cookie *http.Cookie, keys ...config.KeyPair) string {
+	t.Helper()
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(cookie)
+	state, err := newCookieStorer(keys, false).ReadState(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, _ := state.Get(authboss.CookieRemember)
+	return token
+}
+
+func TestCookieStorer(t *testing.T) {
+	tests := []struct {
+		name  string
+		write []config.KeyPair
+		read  []config.KeyPair
+		want  string
+	}{
+		{"same key", []config.KeyPair{oldKey}, []config.KeyPair{oldKey}, "token"},
+		{"old key after a rotation", []config.KeyPair{oldKey}, []config.KeyPair{newKey, oldKey}, "token"},
+		{"written with the current key", []config.KeyPair{newKey, oldKey}, []config.KeyPair{newKey}, "token"},
+		{"not with the previous key", []config.KeyPair{newKey, oldKey}, []config.KeyPair{oldKey}, ""},
+		{"retired key", []config.KeyPair{oldKey}, []config.KeyPair{newKey}, ""},
+		{"encrypted", []config.KeyPair{encKey}, []config.KeyPair{encKey}, "token"},
+		{"encrypted, read without the block key", []config.KeyPair{encKey}, []config.KeyPair{{Hash: encKey.Hash}}, ""},
+	}
+
+	for _, tt := range tests {
+		if got := remembered(t, remember(t, tt.write...), tt.read...); got != tt.want {
+			t.Errorf("%s: read %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+// payload is the value carried by a cookie written by securecookie, which
+// encodes the time, the value and its MAC
+func payload(t *testing.T, cookie *http.Cookie) []byte {
+	t.Helper()
+
+	b, err := base64.URLEncoding.DecodeString(cookie.Value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := bytes.SplitN(b, []byte("|"), 3)
+	if len(parts) != 3 {
+		t.Fatalf("%q is not a securecookie value", b)
+	}
+	value, err := base64.URLEncoding.DecodeString(string(parts[1]))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return value
+}
+
+func TestCookieStorerEncrypts(t *testing.T) {
+	if p := payload(t, remember(t, config.KeyPair{Hash: encKey.Hash})); !bytes.Contains(p, []byte("token")) {
+		t.Fatalf("the token is not in the payload %q of a signed cookie", p)
+	}
+	if p := payload(t, remember(t, encKey)); bytes.Contains(p, []byte("token")) {
+		t.Errorf("the token is readable in the payload %q of a cookie written with a block key", p)
+	}
+}
+
+func TestSessionStoreLogsUndecodableCookies(t *testing.T) {
+	old := sessions.NewCookieStore(keyPairs([]config.KeyPair{oldKey})...)
+	rec := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	session, _ := old.New(r, sessionCookieName)
+	session.Values["uid"] = testEmail
+	if err := session.Save(r, rec); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	store := sessionStore{sessions.NewCookieStore(keyPairs([]config.KeyPair{newKey})...)}
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	r = r.WithContext(logging.NewContext(r.Context(), logging.New(&buf, logging.LevelDebug, logging.FormatJSON)))
+	for _, c := range rec.Result().Cookies() {
+		r.AddCookie(c)
+	}
+
+	session, err := store.Get(r, sessionCookieName)
+	if err != nil {
+		t.Fatalf("a session written with a retired key failed the request: %v", err)
+	}
+	if !session.IsNew || len(session.Values) > 0 {
+		t.Errorf("got the session %v, want a new one", session.Values)
+	}
+	if !strings.Contains(buf.String(), `"level":"debug"`) || !strings.Contains(buf.String(), `"cookie":"`+sessionCookieName+`"`) {
+		t.Errorf("the undecodable cookie was not logged at debug level:\n%s", buf.String())
+	}
+}
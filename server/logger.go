@@ -0,0 +1,130 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/nbycomp/login-consent/logging"
+	"github.com/nbycomp/login-consent/proxy"
+	"github.com/nbycomp/login-consent/session"
+	"github.com/volatiletech/authboss"
+	abclientstate "github.com/volatiletech/authboss-clientstate"
+)
+
+const requestIDHeader = "X-Request-ID"
+
+// statusRecorder remembers the status code and size of a response
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (s *statusRecorder) WriteHeader(code int) {
+	if s.status == 0 {
+		s.status = code
+	}
+	s.ResponseWriter.WriteHeader(code)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	n, err := s.ResponseWriter.Write(b)
+	s.bytes += n
+	return n, err
+}
+
+// logger logs every request, and with the debug settings the session, the
+// users and the context, redacted
+func (s *Server) logger(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		id := r.Header.Get(requestIDHeader)
+		if id == "" {
+			id = newRequestID()
+		}
+		w.Header().Set(requestIDHeader, id)
+
+		log := s.log.With(
+			"request_id", id,
+			"method", r.Method,
+			"path", r.URL.Path,
+			"remote_addr", r.RemoteAddr,
+			"client_ip", proxy.ClientIP(r),
+			"scheme", proxy.Scheme(r),
+		)
+		r = r.WithContext(logging.NewContext(logging.WithRequestID(r.Context(), id), log))
+
+		if s.cfg.Debug {
+			if values := s.sessionValues(r); values != nil {
+				log.Debug("session", "values", logging.Redact(values))
+			}
+		}
+
+		if s.cfg.DebugDB {
+			for _, u := range s.db.Snapshot() {
+				log.Debug("database", "user", logging.Redact(u))
+			}
+		}
+
+		if s.cfg.DebugCTX {
+			if val := r.Context().Value(authboss.CTXKeyData); val != nil {
+				log.Debug("context data", "data", logging.Redact(val))
+			}
+			if val := r.Context().Value(authboss.CTXKeyValues); val != nil {
+				log.Debug("context values", "values", logging.Redact(val))
+			}
+		}
+
+		rec := &statusRecorder{ResponseWriter: w}
+		h.ServeHTTP(rec, r)
+
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		s.metrics.ObserveRequest(r, rec.status, time.Since(start))
+		log.Info("request",
+			"status", rec.status,
+			"bytes", rec.bytes,
+			"duration_ms", float64(time.Since(start).Microseconds())/1000,
+			"user_agent", r.UserAgent(),
+		)
+	})
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+
+	return hex.EncodeToString(b)
+}
+
+// sessionValues reads the session of the request for debugging, wherever it
+// is kept
+func (s *Server) sessionValues(r *http.Request) interface{} {
+	if storer, ok := s.sessionState.(abclientstate.SessionStorer); ok {
+		session, err := storer.Store.Get(r, storer.Name)
+		if err != nil {
+			return nil
+		}
+		return session.Values
+	}
+
+	state, err := s.sessionState.ReadState(r)
+	if err != nil {
+		return nil
+	}
+	if st, ok := state.(*session.State); ok {
+		return st.Values()
+	}
+
+	return nil
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+)
+
+// NewHTTPServer creates a server for handler with the configured timeouts,
+// so slow clients cannot hold connections open
+func (s *Server) NewHTTPServer(addr string, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: s.cfg.ReadHeaderTimeout,
+		ReadTimeout:       s.cfg.ReadTimeout,
+		WriteTimeout:      s.cfg.WriteTimeout,
+		IdleTimeout:       s.cfg.IdleTimeout,
+	}
+}
+
+// Serve runs the servers, with TLS when they have a TLSConfig, until ctx is
+// done or one of them fails. It then stops accepting connections and waits
+// up to shutdown_timeout for the requests in flight to complete, so a
+// rolling deploy does not interrupt users in the middle of a login. The
+// error is that of the server that failed or of a shutdown that timed out.
+func (s *Server) Serve(ctx context.Context, servers ...*http.Server) error {
+	listeners := make([]net.Listener, 0, len(servers))
+	for _, srv := range servers {
+		l, err := net.Listen("tcp", srv.Addr)
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return err
+		}
+		listeners = append(listeners, l)
+	}
+
+	return s.serve(ctx, servers, listeners)
+}
+
+// serve runs each server on the listener at the same index
+func (s *Server) serve(ctx context.Context, servers []*http.Server, listeners []net.Listener) error {
+	errs := make(chan error, len(servers))
+	for i, srv := range servers {
+		go func(srv *http.Server, l net.Listener) {
+			s.log.Info("listening", "addr", l.Addr().String(), "tls", srv.TLSConfig != nil)
+
+			var err error
+			if srv.TLSConfig != nil {
+				err = srv.ServeTLS(l, "", "")
+			} else {
+				err = srv.Serve(l)
+			}
+			if err != http.ErrServerClosed {
+				errs <- err
+			}
+		}(srv, listeners[i])
+	}
+
+	var failed error
+	select {
+	case <-ctx.Done():
+		s.log.Info("shutting down", "timeout", s.cfg.ShutdownTimeout.String())
+	case failed = <-errs:
+		s.log.Error("server failed, shutting down", "error", failed)
+	}
+
+	shutdown, cancel := context.WithTimeout(context.Background(), s.cfg.ShutdownTimeout)
+	defer cancel()
+
+	for i, srv := range servers {
+		if err := srv.Shutdown(shutdown); err != nil && failed == nil {
+			failed = fmt.Errorf("requests to %s did not complete before the shutdown timeout: %v", listeners[i].Addr(), err)
+		}
+	}
+
+	return failed
+}
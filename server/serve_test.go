@@ -0,0 +1,137 @@
+package server
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/nbycomp/login-consent/config"
+)
+
+// slowHandler answers once released, telling when a request has arrived
+type slowHandler struct {
+	arrived chan struct{}
+	release chan struct{}
+}
+
+func newSlowHandler() *slowHandler {
+	return &slowHandler{arrived: make(chan struct{}, 1), release: make(chan struct{})}
+}
+
+func (h *slowHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.arrived <- struct{}{}
+	<-h.release
+	w.Write([]byte("done"))
+}
+
+type result struct {
+	status int
+	body   string
+	err    error
+}
+
+// startServe serves handler until the returned context is cancelled
+func startServe(t *testing.T, s *Server, handler http.Handler) (string, context.CancelFunc, chan error) {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- s.serve(ctx, []*http.Server{s.NewHTTPServer(l.Addr().String(), handler)}, []net.Listener{l})
+	}()
+
+	return "http://" + l.Addr().String(), cancel, done
+}
+
+func get(url string) chan result {
+	c := make(chan result, 1)
+	go func() {
+		res, err := http.Get(url)
+		if err != nil {
+			c <- result{err: err}
+			return
+		}
+		defer res.Body.Close()
+
+		b, err := ioutil.ReadAll(res.Body)
+		c <- result{status: res.StatusCode, body: string(b), err: err}
+	}()
+
+	return c
+}
+
+func TestServeCompletesRequestsInFlight(t *testing.T) {
+	s := newTestServer(t, "http://127.0.0.1:1", func(cfg *config.Config) {
+		cfg.ShutdownTimeout = 5 * time.Second
+	})
+	handler := newSlowHandler()
+	url, shutdown, done := startServe(t, s, handler)
+
+	res := get(url)
+	<-handler.arrived
+	shutdown()
+
+	// New connections are refused once the shutdown has begun
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		conn, err := net.Dial("tcp", url[len("http://"):])
+		if err != nil {
+			break
+		}
+		conn.Close()
+		if time.Now().After(deadline) {
+			t.Fatal("still accepting connections after the shutdown began")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	select {
+	case err := <-done:
+		t.Fatalf("serve returned with a request in flight: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(handler.release)
+
+	r := <-res
+	if r.err != nil {
+		t.Fatalf("request in flight failed: %v", r.err)
+	}
+	if r.status != http.StatusOK || r.body != "done" {
+		t.Errorf("request in flight got %d %q, want 200 \"done\"", r.status, r.body)
+	}
+
+	if err := <-done; err != nil {
+		t.Errorf("serve: %v", err)
+	}
+}
+
+func TestServeGivesUpAfterShutdownTimeout(t *testing.T) {
+	s := newTestServer(t, "http://127.0.0.1:1", func(cfg *config.Config) {
+		cfg.ShutdownTimeout = 50 * time.Millisecond
+	})
+	handler := newSlowHandler()
+	defer close(handler.release)
+	url, shutdown, done := startServe(t, s, handler)
+
+	get(url)
+	<-handler.arrived
+	shutdown()
+
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("serve reported no error although a request did not complete")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("serve did not give up after the shutdown timeout")
+	}
+}
@@ -0,0 +1,501 @@
+// Package server assembles the login and consent UI: authboss, the user and
+// session stores, the Hydra client and the router. A Server is an
+// http.Handler, so it can be embedded in other services or run with
+// httptest, and several can live in one process.
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"database/sql"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/gorilla/sessions"
+	"github.com/justinas/nosurf"
+	_ "github.com/lib/pq"
+	"github.com/volatiletech/authboss"
+	abclientstate "github.com/volatiletech/authboss-clientstate"
+	abrenderer "github.com/volatiletech/authboss-renderer"
+	_ "github.com/volatiletech/authboss/auth"
+	"github.com/volatiletech/authboss/defaults"
+	_ "github.com/volatiletech/authboss/lock"
+	_ "github.com/volatiletech/authboss/logout"
+	"github.com/volatiletech/authboss/otp/twofactor"
+	"github.com/volatiletech/authboss/otp/twofactor/totp2fa"
+
+	"github.com/nbycomp/login-consent/audit"
+	"github.com/nbycomp/login-consent/config"
+	"github.com/nbycomp/login-consent/health"
+	"github.com/nbycomp/login-consent/i18n"
+	"github.com/nbycomp/login-consent/logging"
+	"github.com/nbycomp/login-consent/login"
+	"github.com/nbycomp/login-consent/metrics"
+	"github.com/nbycomp/login-consent/model"
+	"github.com/nbycomp/login-consent/proxy"
+	"github.com/nbycomp/login-consent/ratelimit"
+	"github.com/nbycomp/login-consent/repo"
+	"github.com/nbycomp/login-consent/secure"
+	"github.com/nbycomp/login-consent/session"
+	"github.com/nbycomp/login-consent/tlsutil"
+)
+
+const (
+	sessionCookieName = "nbycomp"
+
+	// The templates and static files are read relative to the working
+	// directory unless set with WithViewsDir and WithStaticDir
+	viewsDir  = "ab_views"
+	staticDir = "static"
+)
+
+// ErrCookieSessions is returned when listing or revoking sessions that are
+// kept in cookies, which the server cannot see
+var ErrCookieSessions = errors.New("sessions are kept in cookies")
+
+// Server is the login and consent UI
+type Server struct {
+	cfg config.Config
+
+	ab           *authboss.Authboss
+	db           *repo.MemStorer
+	sessionState authboss.ClientStateReadWriter
+	sessions     session.Store
+	cookieStore  cookieStorer
+	hydra        *login.Hydra
+	revoker      *login.Revoker
+	metrics      *metrics.Metrics
+
+	checker  *health.Checker
+	imported *health.Gate
+
+	viewsDir  string
+	staticDir string
+	log       *logging.Logger
+	audit     audit.Sink
+
+	trusted   proxy.Trusted
+	tlsConfig *tls.Config
+	handler   http.Handler
+}
+
+// Option customises a Server
+type Option func(*Server)
+
+// WithSessionStore keeps sessions in store, such as one backed by Redis,
+// whatever session_store is set to
+func WithSessionStore(store session.Store) Option {
+	return func(s *Server) {
+		s.sessions = store
+	}
+}
+
+// WithViewsDir reads the templates from dir, which holds the
+// html-templates directory
+func WithViewsDir(dir string) Option {
+	return func(s *Server) {
+		s.viewsDir = dir
+	}
+}
+
+// WithStaticDir serves the style sheet, images and fonts under
+// /auth/static from dir
+func WithStaticDir(dir string) Option {
+	return func(s *Server) {
+		s.staticDir = dir
+	}
+}
+
+// WithLogger writes the log lines of the server to log rather than to
+// stdout
+func WithLogger(log *logging.Logger) Option {
+	return func(s *Server) {
+		s.log = log
+	}
+}
+
+// WithAuditSink records the audit events of the server in sink rather than
+// discarding them. The sink is not closed with the server.
+func WithAuditSink(sink audit.Sink) Option {
+	return func(s *Server) {
+		s.audit = sink
+	}
+}
+
+// New creates a server from a configuration validated by config.Load, and
+// fails with the problems Validate reports. Users are not imported until
+// ImportUsers is called.
+func New(cfg config.Config, opts ...Option) (*Server, error) {
+	parsed, err := parseSettings(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		cfg:       cfg,
+		ab:        authboss.New(),
+		db:        repo.NewMemStorer(),
+		checker:   health.NewChecker(),
+		viewsDir:  viewsDir,
+		staticDir: staticDir,
+		audit:     audit.Discard{},
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.log == nil {
+		s.log = logging.New(os.Stdout, parsed.logLevel, cfg.LogFormat)
+	}
+	s.trusted = parsed.trusted
+
+	s.metrics = metrics.New(s.db.Count)
+
+	if s.hydra, err = login.NewHydra(cfg, s.log, s.metrics); err != nil {
+		return nil, err
+	}
+
+	if cfg.TLSCertFile != "" {
+		if s.tlsConfig, err = tlsutil.ServerConfig(cfg.TLSCertFile, cfg.TLSKeyFile, s.log); err != nil {
+			return nil, err
+		}
+	}
+
+	// Cookies are only sent over https when users reach the service that way,
+	// whether it terminates TLS itself or sits behind a proxy that does
+	secureCookies := strings.HasPrefix(cfg.RootURL, "https://")
+
+	cookieKeys, err := cfg.CookieKeys()
+	if err != nil {
+		return nil, err
+	}
+	sessionKeys, err := cfg.SessionKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	s.cookieStore = newCookieStorer(s.storeKeys("cookie_store_key", cookieKeys), secureCookies)
+	sessionKeyPairs := keyPairs(s.storeKeys("session_store_key", sessionKeys))
+
+	if s.sessions == nil && cfg.SessionStore != config.SessionStoreCookie {
+		if s.sessions, err = newSessionStore(cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	if s.sessions == nil {
+		cStore := sessions.NewCookieStore(sessionKeyPairs...)
+		cStore.Options.HttpOnly = true
+		cStore.Options.Secure = secureCookies
+		cStore.MaxAge(int(cfg.SessionTTL / time.Second))
+		s.sessionState = abclientstate.NewSessionStorerFromExisting(sessionCookieName, sessionStore{cStore})
+	} else {
+		storer := session.NewStorer(sessionCookieName, s.sessions, cfg.SessionTTL, sessionKeyPairs...)
+		storer.Secure = secureCookies
+		s.sessionState = storer
+
+		if p, ok := s.sessions.(interface{ Ping(context.Context) error }); ok {
+			s.checker.Add("sessions", p.Ping)
+		}
+	}
+
+	ab := s.ab
+	ab.Config.Storage.Server = s.db
+	ab.Config.Storage.SessionState = s.sessionState
+	ab.Config.Storage.CookieState = s.cookieStore
+
+	s.revoker = login.NewRevoker(s.hydra, s.log)
+	s.db.Revoker = s.revoker
+
+	s.checker.Add("users", s.db.Ping)
+
+	// The import runs while the server starts, which reports not ready
+	// until it is done
+	if cfg.ImportUsers != "" {
+		s.imported = s.checker.Gate("import")
+	}
+
+	ab.Config.Paths.Mount = "/auth"
+	ab.Config.Core.ViewRenderer = abrenderer.NewHTML(ab.Config.Paths.Mount, s.viewsDir)
+	ab.Config.Modules.LogoutMethod = http.MethodGet
+	ab.Config.Modules.RegisterPreserveFields = []string{"email", "name"}
+	ab.Config.Modules.TOTP2FAIssuer = "Nearby Computing"
+	ab.Config.Modules.RoutesRedirectOnUnauthed = true
+	ab.Config.Modules.LockAfter = cfg.LockAfter
+	ab.Config.Modules.LockWindow = cfg.LockWindow
+	ab.Config.Modules.LockDuration = cfg.LockDuration
+	ab.Config.Paths.LockNotOK = ab.Config.Paths.Mount + "/login"
+
+	ab.Config.Paths.RootURL = cfg.RootURL
+
+	defaults.SetCore(&ab.Config, false, false)
+	ab.Config.Core.Logger = logging.Authboss{Logger: s.log}
+	ab.Config.Core.ErrorHandler = defaults.NewErrorHandler(logging.Authboss{Logger: s.log})
+	ab.Config.Core.Redirector = login.LockRedirector(ab)
+
+	if err := ab.Init(); err != nil {
+		return nil, err
+	}
+
+	totp := &totp2fa.TOTP{Authboss: ab}
+	if err := totp.Setup(); err != nil {
+		return nil, err
+	}
+
+	recovery := &twofactor.Recovery{Authboss: ab}
+	if err := recovery.Setup(); err != nil {
+		return nil, err
+	}
+
+	s.checker.Add("hydra", s.hydra.Ping)
+	s.checker.Add("templates", func(ctx context.Context) error {
+		_, _, err := ab.Config.Core.ViewRenderer.Render(ctx, login.PageError, authboss.HTMLData{})
+		return err
+	})
+
+	login.Metrics(ab, s.metrics)
+	login.Audit(ab)
+
+	if err := ab.Config.Core.ViewRenderer.Load(login.PageError, login.PageLogout, login.PageApps, login.PageAccount); err != nil {
+		return nil, err
+	}
+
+	mux := chi.NewRouter()
+
+	mux.Use(s.trusted.Middleware,
+		s.logger,
+		s.auditTo,
+		secure.Middleware(secure.Options{HSTSMaxAge: cfg.HSTSMaxAge, Scheme: proxy.Scheme}),
+		s.checkScheme(secureCookies),
+		csrf(secureCookies),
+		ab.LoadClientStateMiddleware,
+		i18n.Middleware,
+		s.dataInjector,
+		authboss.ModuleListMiddleware(ab),
+	)
+
+	mux.Route(ab.Config.Paths.Mount, func(mux chi.Router) {
+		mws := chi.Chain(
+			login.RateLimitMiddleware(ab, ratelimit.NewLimiter(parsed.ipRate), ratelimit.NewLimiter(parsed.accountRate), proxy.ClientIP, s.metrics),
+			login.LoginMiddleware(ab, s.hydra),
+			login.LogoutMiddleware(ab, s.hydra, cfg.LogoutConfirm),
+			login.AuditMiddleware(ab),
+		)
+		// Only the login and consent flows may be framed by the
+		// frame_ancestors, the account pages never are
+		embeddable := secure.Override(secure.AllowFraming(parsed.frameAncestors))
+		mux.With(embeddable).Mount("/", http.StripPrefix(ab.Config.Paths.Mount, mws.Handler(ab.Config.Core.Router)))
+		mux.With(embeddable).Mount("/consent", login.Consent(ab, s.hydra))
+		mux.Mount("/apps", login.Apps(ab, s.hydra))
+		mux.Mount("/account", login.Account(ab))
+
+		fs := http.FileServer(http.Dir(s.staticDir))
+		mux.Mount("/static/", http.StripPrefix(ab.Config.Paths.Mount+"/static/", fs))
+	})
+
+	// The probes bypass the middleware, so they are not logged and need no
+	// session
+	root := http.NewServeMux()
+	root.Handle("/healthz", health.Alive())
+	root.Handle("/readyz", s.checker.Ready())
+	root.Handle("/", mux)
+	s.handler = root
+
+	return s, nil
+}
+
+// ServeHTTP serves the UI under /auth, and the /healthz and /readyz probes
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.handler.ServeHTTP(w, r)
+}
+
+// MetricsHandler serves the metrics, which should not be reachable through
+// the public port
+func (s *Server) MetricsHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", s.metrics.Handler())
+	return mux
+}
+
+// TLSConfig is the configuration to serve the UI with, or nil when TLS is
+// terminated elsewhere
+func (s *Server) TLSConfig() *tls.Config {
+	return s.tlsConfig
+}
+
+// Authboss returns the authboss instance of the server
+func (s *Server) Authboss() *authboss.Authboss {
+	return s.ab
+}
+
+// Users returns the user store of the server
+func (s *Server) Users() *repo.MemStorer {
+	return s.db
+}
+
+// ImportUsers imports the users file given as import_users, after which the
+// server reports ready
+func (s *Server) ImportUsers() error {
+	filename := s.cfg.ImportUsers
+	if filename == "" {
+		return nil
+	}
+
+	s.log.Info("importing users", "file", filename)
+	if err := repo.Import(s.logContext(), filename, s.db); err != nil {
+		return err
+	}
+	s.imported.Open()
+	s.log.Info("imported users", "file", filename, "users", s.db.Count())
+
+	return nil
+}
+
+// ReloadUsers brings the user store in line with the users file, revoking
+// the access of users that were removed or disabled
+func (s *Server) ReloadUsers() error {
+	filename := s.cfg.ImportUsers
+	if filename == "" {
+		return nil
+	}
+
+	s.log.Info("reloading users", "file", filename)
+	return repo.Sync(s.logContext(), filename, s.db)
+}
+
+// logContext carries the logger of the server for work done outside of a
+// request
+func (s *Server) logContext() context.Context {
+	return logging.NewContext(context.Background(), s.log)
+}
+
+// Sessions lists the sessions of a user, when they are kept on the server
+func (s *Server) Sessions(ctx context.Context, pid string) ([]session.Session, error) {
+	if s.sessions == nil {
+		return nil, ErrCookieSessions
+	}
+
+	return s.sessions.List(ctx, pid)
+}
+
+// RevokeSessions logs a user out of every session, when they are kept on
+// the server
+func (s *Server) RevokeSessions(ctx context.Context, pid string) error {
+	if s.sessions == nil {
+		return ErrCookieSessions
+	}
+
+	return session.Revoke(ctx, s.sessions, pid)
+}
+
+// Close stops revoking the Hydra sessions of removed users and releases the
+// user and session stores
+func (s *Server) Close() error {
+	if err := s.revoker.Close(); err != nil {
+		return err
+	}
+
+	// The memory stores hold nothing to release, other stores may
+	for _, store := range []interface{}{s.db, s.sessions} {
+		if c, ok := store.(io.Closer); ok {
+			if err := c.Close(); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// newSessionStore opens the store that keeps sessions on the server
+func newSessionStore(cfg config.Config) (session.Store, error) {
+	if cfg.SessionStore == config.SessionStoreMemory {
+		return session.NewMemoryStore(), nil
+	}
+
+	db, err := sql.Open("postgres", cfg.SessionStoreDSN)
+	if err != nil {
+		return nil, err
+	}
+
+	store, err := session.NewSQLStore(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return store, nil
+}
+
+// checkScheme warns, once, when users reach the service over https through
+// a proxy while root_url is http, which leaves cookies without Secure
+func (s *Server) checkScheme(secureCookies bool) func(http.Handler) http.Handler {
+	var once sync.Once
+	return func(handler http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !secureCookies && proxy.Scheme(r) == "https" {
+				once.Do(func() {
+					logging.FromContext(r.Context()).Warn("requests arrive over https but root_url is not https, so cookies are not marked Secure", "root_url", s.cfg.RootURL)
+				})
+			}
+			handler.ServeHTTP(w, r)
+		})
+	}
+}
+
+// csrf protects against cross-site request forgery, with the token cookie
+// marked Secure when the service is reached over https
+func csrf(secure bool) func(http.Handler) http.Handler {
+	return func(handler http.Handler) http.Handler {
+		h := nosurf.New(handler)
+		h.SetBaseCookie(http.Cookie{MaxAge: nosurf.MaxAge, Secure: secure})
+		return h
+	}
+}
+
+// auditTo records the audit events of requests in the sink of the server
+func (s *Server) auditTo(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.ServeHTTP(w, r.WithContext(audit.NewContext(r.Context(), s.audit)))
+	})
+}
+
+func (s *Server) dataInjector(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data := s.layoutData(w, &r)
+		r = r.WithContext(context.WithValue(r.Context(), authboss.CTXKeyData, data))
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// layoutData is passing pointers to pointers be able to edit the current pointer
+// to the request. This is still safe as it still creates a new request and doesn't
+// modify the old one, it just modifies what we're pointing to in our methods so
+// we're able to skip returning an *http.Request everywhere
+func (s *Server) layoutData(w http.ResponseWriter, r **http.Request) authboss.HTMLData {
+	var loggedIn bool
+	var currentUserName string
+
+	if user, err := model.GetUser(s.ab, r); user != nil && err == nil {
+		loggedIn = true
+		currentUserName = user.Name
+	}
+
+	lang := i18n.FromContext((*r).Context())
+
+	return authboss.HTMLData{
+		"lang":              lang,
+		"t":                 i18n.Get(lang),
+		"loggedin":          loggedIn,
+		"current_user_name": currentUserName,
+		"csrf_token":        nosurf.Token(*r),
+		"csp_nonce":         secure.Nonce(*r),
+		"flash_success":     authboss.FlashSuccess(w, *r),
+		"flash_error":       authboss.FlashError(w, *r),
+	}
+}
@@ -0,0 +1,927 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/volatiletech/authboss"
+
+	"github.com/nbycomp/login-consent/audit"
+	"github.com/nbycomp/login-consent/config"
+	"github.com/nbycomp/login-consent/hydratest"
+	"github.com/nbycomp/login-consent/logging"
+	"github.com/nbycomp/login-consent/login"
+	"github.com/nbycomp/login-consent/model"
+	"github.com/nbycomp/login-consent/secure"
+	"github.com/nbycomp/login-consent/session"
+)
+
+const (
+	testEmail    = "rick@councilofricks.com"
+	testPassword = "1234"
+	testSubject  = "5f0d7a3e-2c1b-4f4e-9a57-0e3c1f6a9b21"
+)
+
+// testUsers both have the password 1234
+const testUsers = `[
+	{"id": "5f0d7a3e-2c1b-4f4e-9a57-0e3c1f6a9b21", "name": "Rick", "email": "rick@councilofricks.com", "password": "$2a$10$902mhGNsIGEJ7mCzsqzE9e/EBwGqTbQl3QaMAozGFCCOjOE2NmHSq", "role": "admin"},
+	{"id": "c2b3a1d0-5e6f-4a7b-8c9d-0e1f2a3b4c5d", "name": "Morty", "email": "morty@councilofricks.com", "password": "$2a$10$902mhGNsIGEJ7mCzsqzE9e/EBwGqTbQl3QaMAozGFCCOjOE2NmHSq", "role": "user", "disabled": true}
+]`
+
+// newTestServer creates a server talking to the Hydra admin API at
+// hydraURL, reading the templates and static files of the repository and
+// logging nowhere. Rate limits are off unless change sets them.
+func newTestServer(t *testing.T, hydraURL string, change func(*config.Config), opts ...Option) *Server {
+	t.Helper()
+
+	cfg := config.Default()
+	cfg.HydraAdminURL = hydraURL
+	cfg.RootURL = "http://login.test"
+	cfg.RateLimitIP = "off"
+	cfg.RateLimitAccount = "off"
+	if change != nil {
+		change(&cfg)
+	}
+
+	opts = append([]Option{
+		WithViewsDir("../ab_views"),
+		WithStaticDir("../static"),
+		WithLogger(logging.New(ioutil.Discard, logging.LevelError, logging.FormatJSON)),
+	}, opts...)
+
+	s, err := New(cfg, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s
+}
+
+// flow is a server with the test users, a fake Hydra and a browser
+type flow struct {
+	t     *testing.T
+	hydra *hydratest.Server
+	srv   *Server
+	web   *httptest.Server
+	*browser
+
+	// close stops the servers and removes the users file
+	close func()
+}
+
+func newFlow(t *testing.T, change func(*config.Config), opts ...Option) *flow {
+	t.Helper()
+
+	users, err := ioutil.TempFile("", "users-*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	users.WriteString(testUsers)
+	users.Close()
+
+	hydra := hydratest.NewServer()
+	srv := newTestServer(t, hydra.URL, func(cfg *config.Config) {
+		cfg.ImportUsers = users.Name()
+		if change != nil {
+			change(cfg)
+		}
+	}, opts...)
+	if err := srv.ImportUsers(); err != nil {
+		t.Fatal(err)
+	}
+
+	web := httptest.NewServer(srv)
+	f := &flow{t: t, hydra: hydra, srv: srv, web: web}
+	f.browser = f.newBrowser()
+	f.close = func() {
+		web.Close()
+		hydra.Close()
+		srv.Close()
+		os.Remove(users.Name())
+	}
+
+	return f
+}
+
+// browser keeps cookies and does not follow redirects, so each step of a
+// flow can be checked
+type browser struct {
+	t      *testing.T
+	base   string
+	client *http.Client
+
+	// header is sent with every request
+	header http.Header
+}
+
+func (f *flow) newBrowser() *browser {
+	jar, _ := cookiejar.New(nil)
+	return &browser{
+		t:      f.t,
+		header: http.Header{},
+		base:   f.web.URL,
+		client: &http.Client{
+			Jar: jar,
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+// page is a response with its body read
+type page struct {
+	*http.Response
+	body string
+}
+
+func (b *browser) get(path string) page {
+	b.t.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, b.base+path, nil)
+	if err != nil {
+		b.t.Fatal(err)
+	}
+
+	return b.do(req)
+}
+
+func (b *browser) post(path string, form url.Values) page {
+	b.t.Helper()
+
+	req, err := http.NewRequest(http.MethodPost, b.base+path, strings.NewReader(form.Encode()))
+	if err != nil {
+		b.t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	return b.do(req)
+}
+
+func (b *browser) do(req *http.Request) page {
+	b.t.Helper()
+
+	for k, v := range b.header {
+		req.Header[k] = v
+	}
+
+	res, err := b.client.Do(req)
+	if err != nil {
+		b.t.Fatal(err)
+	}
+
+	return b.read(res)
+}
+
+func (b *browser) read(res *http.Response) page {
+	b.t.Helper()
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		b.t.Fatal(err)
+	}
+
+	return page{Response: res, body: string(body)}
+}
+
+var csrfInput = regexp.MustCompile(`name="csrf_token" value="([^"]+)"`)
+
+// csrfToken is the token of the first form on the page
+func (p page) csrfToken(t *testing.T) string {
+	t.Helper()
+
+	m := csrfInput.FindStringSubmatch(p.body)
+	if m == nil {
+		t.Fatalf("no csrf_token on the page:\n%s", p.body)
+	}
+
+	return html.UnescapeString(m[1])
+}
+
+// wantRedirect checks that the response sends the browser back to Hydra
+func (p page) wantRedirect(t *testing.T, result string) {
+	t.Helper()
+
+	if p.StatusCode != http.StatusFound {
+		t.Fatalf("got status %d, want a redirect back to hydra:\n%s", p.StatusCode, p.body)
+	}
+	u, err := url.Parse(p.Header.Get("Location"))
+	if err != nil || !strings.HasPrefix(u.String(), hydratest.RedirectURL) || u.Query().Get("result") != result {
+		t.Fatalf("redirected to %q, want the %s redirect of hydra", p.Header.Get("Location"), result)
+	}
+}
+
+// login fills in the login form of challenge
+func (b *browser) login(ch, email, password string) page {
+	b.t.Helper()
+
+	form := b.get("/auth/login?login_challenge=" + url.QueryEscape(ch))
+	if form.StatusCode != http.StatusOK {
+		b.t.Fatalf("login form answered %d:\n%s", form.StatusCode, form.body)
+	}
+
+	return b.post("/auth/login", url.Values{
+		"email":      {email},
+		"password":   {password},
+		"challenge":  {ch},
+		"csrf_token": {form.csrfToken(b.t)},
+	})
+}
+
+// accepted decodes the body with which the request was accepted
+func (f *flow) accepted(flow, ch string) map[string]interface{} {
+	f.t.Helper()
+
+	call, ok := f.hydra.Accepted(flow, ch)
+	if !ok {
+		f.t.Fatalf("the %s request %s was not accepted", flow, ch)
+	}
+
+	var body map[string]interface{}
+	if len(call.Body) > 0 {
+		if err := call.Decode(&body); err != nil {
+			f.t.Fatal(err)
+		}
+	}
+
+	return body
+}
+
+// rejected decodes the body with which the request was rejected
+func (f *flow) rejected(flow, ch string) map[string]interface{} {
+	f.t.Helper()
+
+	call, ok := f.hydra.Rejected(flow, ch)
+	if !ok {
+		f.t.Fatalf("the %s request %s was not rejected", flow, ch)
+	}
+
+	var body map[string]interface{}
+	if err := call.Decode(&body); err != nil {
+		f.t.Fatal(err)
+	}
+
+	return body
+}
+
+// wantJSON compares v to want by their JSON encoding
+func wantJSON(t *testing.T, name string, v interface{}, want string) {
+	t.Helper()
+
+	got, _ := json.Marshal(v)
+	var a, b interface{}
+	json.Unmarshal(got, &a)
+	if err := json.Unmarshal([]byte(want), &b); err != nil {
+		t.Fatal(err)
+	}
+
+	ga, _ := json.Marshal(a)
+	gb, _ := json.Marshal(b)
+	if string(ga) != string(gb) {
+		t.Errorf("%s = %s, want %s", name, ga, gb)
+	}
+}
+
+func testLoginRequest(ch string) login.LoginRequest {
+	return login.LoginRequest{
+		Challenge:      ch,
+		Client:         login.Client{ClientID: "app", ClientName: "App"},
+		RequestURL:     "http://hydra.test/oauth2/auth?client_id=app",
+		RequestedScope: []string{"openid", "profile"},
+	}
+}
+
+func TestLogin(t *testing.T) {
+	f := newFlow(t, nil)
+	defer f.close()
+	f.hydra.AddLogin(testLoginRequest("l1"))
+
+	start := time.Now().Unix()
+	f.login("l1", testEmail, testPassword).wantRedirect(t, "accept")
+
+	body := f.accepted("login", "l1")
+	authTime, _ := body["context"].(map[string]interface{})["auth_time"].(float64)
+	if int64(authTime) < start || int64(authTime) > time.Now().Unix() {
+		t.Errorf("auth_time = %v, want the time of the login", authTime)
+	}
+	delete(body["context"].(map[string]interface{}), "auth_time")
+
+	wantJSON(t, "accept body", body, `{
+		"subject": "`+testSubject+`",
+		"remember": true,
+		"remember_for": 3600,
+		"acr": "pwd",
+		"amr": ["pwd"],
+		"context": {"acr": "pwd", "amr": ["pwd"]}
+	}`)
+}
+
+func TestLoginWithWrongPassword(t *testing.T) {
+	f := newFlow(t, nil)
+	defer f.close()
+	f.hydra.AddLogin(testLoginRequest("l1"))
+
+	res := f.login("l1", testEmail, "wrong")
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("got status %d, want the login form again", res.StatusCode)
+	}
+	if !strings.Contains(res.body, `name="challenge" value="l1"`) {
+		t.Error("the login form lost the challenge")
+	}
+	if _, ok := f.hydra.Accepted("login", "l1"); ok {
+		t.Error("the login request was accepted with a wrong password")
+	}
+}
+
+func TestLoginWithoutCSRFToken(t *testing.T) {
+	f := newFlow(t, nil)
+	defer f.close()
+	f.hydra.AddLogin(testLoginRequest("l1"))
+
+	f.get("/auth/login?login_challenge=l1")
+	res := f.post("/auth/login", url.Values{
+		"email":     {testEmail},
+		"password":  {testPassword},
+		"challenge": {"l1"},
+	})
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("got status %d, want 400", res.StatusCode)
+	}
+	if _, ok := f.hydra.Accepted("login", "l1"); ok {
+		t.Error("the login request was accepted without a csrf token")
+	}
+}
+
+func TestLoginSkip(t *testing.T) {
+	f := newFlow(t, nil)
+	defer f.close()
+
+	req := testLoginRequest("l1")
+	req.Skip, req.Subject = true, testSubject
+	f.hydra.AddLogin(req)
+
+	f.get("/auth/login?login_challenge=l1").wantRedirect(t, "accept")
+	wantJSON(t, "accept body", f.accepted("login", "l1"), `{"subject": "`+testSubject+`"}`)
+}
+
+func TestLoginSkipRejectsUnknownAndDisabledUsers(t *testing.T) {
+	for ch, subject := range map[string]string{
+		"unknown":  "00000000-0000-0000-0000-000000000000",
+		"disabled": "c2b3a1d0-5e6f-4a7b-8c9d-0e1f2a3b4c5d",
+	} {
+		f := newFlow(t, nil)
+
+		req := testLoginRequest(ch)
+		req.Skip, req.Subject = true, subject
+		f.hydra.AddLogin(req)
+
+		f.get("/auth/login?login_challenge="+ch).wantRedirect(t, "reject")
+		wantJSON(t, ch+" reject body", f.rejected("login", ch), `{
+			"error": "access_denied",
+			"error_description": "The user no longer has access",
+			"status_code": 403
+		}`)
+
+		f.close()
+	}
+}
+
+func TestLoginRejectsDisabledUser(t *testing.T) {
+	f := newFlow(t, nil)
+	defer f.close()
+	f.hydra.AddLogin(testLoginRequest("l1"))
+
+	res := f.login("l1", "morty@councilofricks.com", testPassword)
+	if res.StatusCode != http.StatusForbidden {
+		t.Errorf("got status %d, want 403", res.StatusCode)
+	}
+	if _, ok := f.hydra.Accepted("login", "l1"); ok {
+		t.Error("the login request of a disabled user was accepted")
+	}
+}
+
+// Only the first handler that refuses a login responds
+func TestLoginRejectsDisabledUserAskedForSecondFactor(t *testing.T) {
+	f := newFlow(t, nil)
+	defer f.close()
+
+	req := testLoginRequest("l1")
+	req.OIDCContext.ACRValues = []string{"mfa"}
+	f.hydra.AddLogin(req)
+
+	res := f.login("l1", "morty@councilofricks.com", testPassword)
+	if res.StatusCode != http.StatusForbidden {
+		t.Errorf("got status %d, want 403", res.StatusCode)
+	}
+	if n := strings.Count(res.body, "</html>"); n != 1 {
+		t.Errorf("got %d pages in the response, want 1:\n%s", n, res.body)
+	}
+	if !strings.Contains(res.body, "This account has been disabled.") {
+		t.Errorf("the response does not say the account is disabled:\n%s", res.body)
+	}
+}
+
+// The users are logged while others save them
+func TestDebugDBWhileUsersChange(t *testing.T) {
+	f := newFlow(t, func(cfg *config.Config) { cfg.DebugDB = true })
+	defer f.close()
+
+	stop := make(chan struct{})
+	saved := make(chan struct{})
+	go func() {
+		defer close(saved)
+		ctx := context.Background()
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			f.srv.db.Save(ctx, &model.User{Email: fmt.Sprintf("user%d@example.com", i%50)})
+		}
+	}()
+
+	for i := 0; i < 50; i++ {
+		f.get("/auth/login")
+	}
+	close(stop)
+	<-saved
+}
+
+// The lines logged by the user store during an import go to the logger of
+// the server
+func TestImportLogsToTheServerLogger(t *testing.T) {
+	var buf bytes.Buffer
+	f := newFlow(t, nil, WithLogger(logging.New(&buf, logging.LevelInfo, logging.FormatJSON)))
+	defer f.close()
+
+	for _, email := range []string{testEmail, "morty@councilofricks.com"} {
+		if !strings.Contains(buf.String(), `"msg":"created user","pid":"`+email+`"`) {
+			t.Errorf("the creation of %s was not logged:\n%s", email, buf.String())
+		}
+	}
+}
+
+// Servers in the same process each report their own metrics
+func TestMetricsPerServer(t *testing.T) {
+	f := newFlow(t, nil)
+	defer f.close()
+	other := newTestServer(t, f.hydra.URL, nil)
+	defer other.Close()
+
+	f.get("/auth/login")
+
+	scrape := func(s *Server) string {
+		rec := httptest.NewRecorder()
+		s.MetricsHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		return rec.Body.String()
+	}
+
+	for _, tt := range []struct {
+		srv      *Server
+		users    string
+		requests bool
+	}{
+		{f.srv, "login_consent_users 2\n", true},
+		{other, "login_consent_users 0\n", false},
+	} {
+		got := scrape(tt.srv)
+		if !strings.Contains(got, tt.users) {
+			t.Errorf("the metrics do not contain %q:\n%s", tt.users, got)
+		}
+		if requests := strings.Contains(got, `route="/auth/login"`); requests != tt.requests {
+			t.Errorf("requests to /auth/login reported: %v, want %v", requests, tt.requests)
+		}
+	}
+}
+
+func TestLoginHistoryRecordsClientIP(t *testing.T) {
+	f := newFlow(t, func(cfg *config.Config) { cfg.TrustedProxies = "127.0.0.1/32, ::1/128" })
+	defer f.close()
+	f.hydra.AddLogin(testLoginRequest("l1"))
+
+	f.header.Set("X-Forwarded-For", "203.0.113.7")
+	f.login("l1", testEmail, testPassword).wantRedirect(t, "accept")
+
+	user, err := f.srv.db.Load(context.Background(), testEmail)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logins := user.(*model.User).Logins
+	if len(logins) != 1 || logins[0].IP != "203.0.113.7" {
+		t.Errorf("got logins %+v, want one from 203.0.113.7", logins)
+	}
+}
+
+func TestLoginRateLimit(t *testing.T) {
+	f := newFlow(t, func(cfg *config.Config) { cfg.RateLimitAccount = "1/1m" })
+	defer f.close()
+	f.hydra.AddLogin(testLoginRequest("l1"))
+
+	form := f.get("/auth/login?login_challenge=l1")
+	attempt := url.Values{
+		"email":      {testEmail},
+		"password":   {"wrong"},
+		"challenge":  {"l1"},
+		"csrf_token": {form.csrfToken(t)},
+	}
+	if res := f.post("/auth/login", attempt); res.StatusCode != http.StatusOK {
+		t.Fatalf("first attempt got status %d, want the login form", res.StatusCode)
+	}
+
+	calls := len(f.hydra.Calls())
+	res := f.post("/auth/login", attempt)
+	if res.StatusCode != http.StatusTooManyRequests || res.Header.Get("Retry-After") == "" {
+		t.Errorf("got status %d and Retry-After %q, want 429 with a Retry-After", res.StatusCode, res.Header.Get("Retry-After"))
+	}
+	if !strings.Contains(res.body, `name="challenge" value="l1"`) {
+		t.Error("the login form lost the challenge")
+	}
+	if n := len(f.hydra.Calls()); n != calls {
+		t.Errorf("the throttled attempt made %d calls to hydra", n-calls)
+	}
+}
+
+// events records the audit events of a server
+type events struct {
+	mu     sync.Mutex
+	events []audit.Event
+}
+
+func (e *events) Write(ev audit.Event) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.events = append(e.events, ev)
+	return nil
+}
+
+func (e *events) Close() error { return nil }
+
+func (e *events) count(typ string) int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	n := 0
+	for _, ev := range e.events {
+		if ev.Type == typ {
+			n++
+		}
+	}
+
+	return n
+}
+
+func TestLoginLocksAccount(t *testing.T) {
+	sink := &events{}
+	f := newFlow(t, func(cfg *config.Config) { cfg.LockAfter = 2 }, WithAuditSink(sink))
+	defer f.close()
+	f.hydra.AddLogin(testLoginRequest("l1"))
+
+	if res := f.login("l1", testEmail, "wrong"); res.StatusCode != http.StatusOK {
+		t.Fatalf("first attempt got status %d, want the login form", res.StatusCode)
+	}
+
+	res := f.login("l1", testEmail, "wrong")
+	if res.StatusCode != http.StatusForbidden {
+		t.Errorf("locking attempt got status %d, want 403", res.StatusCode)
+	}
+	if !strings.Contains(res.body, "This account is locked") || !strings.Contains(res.body, `name="challenge" value="l1"`) {
+		t.Errorf("the response is not the login page saying the account is locked:\n%s", res.body)
+	}
+	if n := sink.count(audit.AccountLocked); n != 1 {
+		t.Errorf("got %d %s events, want 1", n, audit.AccountLocked)
+	}
+
+	if res := f.login("l1", testEmail, testPassword); res.StatusCode != http.StatusForbidden {
+		t.Errorf("login on the locked account got status %d, want 403", res.StatusCode)
+	}
+	if _, ok := f.hydra.Accepted("login", "l1"); ok {
+		t.Error("the login request of a locked account was accepted")
+	}
+}
+
+func TestLoginWithSession(t *testing.T) {
+	f := newFlow(t, nil)
+	defer f.close()
+	f.hydra.AddLogin(testLoginRequest("l1"))
+	f.login("l1", testEmail, testPassword).wantRedirect(t, "accept")
+	first := f.accepted("login", "l1")
+
+	// Hydra does not skip, but the browser still has its session
+	f.hydra.AddLogin(testLoginRequest("l2"))
+	f.get("/auth/login?login_challenge=l2").wantRedirect(t, "accept")
+
+	second := f.accepted("login", "l2")
+	wantJSON(t, "accept body", second, mustJSON(first))
+
+	// prompt=login asks for the password again
+	req := testLoginRequest("l3")
+	req.RequestURL += "&prompt=login"
+	f.hydra.AddLogin(req)
+
+	if res := f.get("/auth/login?login_challenge=l3"); res.StatusCode != http.StatusOK {
+		t.Errorf("prompt=login got status %d, want the login form", res.StatusCode)
+	}
+	if _, ok := f.hydra.Accepted("login", "l3"); ok {
+		t.Error("prompt=login was accepted from the session")
+	}
+}
+
+// A session only remembered from the remember me cookie cannot manage
+// applications, like the account page
+func TestAppsRequireFullAuth(t *testing.T) {
+	store := session.NewMemoryStore()
+	f := newFlow(t, nil, WithSessionStore(store))
+	defer f.close()
+	f.hydra.AddLogin(testLoginRequest("l1"))
+	f.login("l1", testEmail, testPassword).wantRedirect(t, "accept")
+
+	for _, path := range []string{"/auth/apps", "/auth/account"} {
+		if res := f.get(path); res.StatusCode != http.StatusOK {
+			t.Fatalf("%s answered %d to a logged in user:\n%s", path, res.StatusCode, res.body)
+		}
+	}
+
+	ctx := context.Background()
+	sessions, err := f.srv.Sessions(ctx, testEmail)
+	if err != nil || len(sessions) != 1 {
+		t.Fatalf("got sessions %v, %v, want the one of the login", sessions, err)
+	}
+	sessions[0].Values[authboss.SessionHalfAuthKey] = "true"
+	if err := store.Save(ctx, sessions[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{"/auth/apps", "/auth/account"} {
+		res := f.get(path)
+		if res.StatusCode != http.StatusFound || !strings.HasPrefix(res.Header.Get("Location"), "/auth/login") {
+			t.Errorf("%s answered %d, location %q, to a remembered session, want a redirect to the login", path, res.StatusCode, res.Header.Get("Location"))
+		}
+	}
+}
+
+func TestLoginHydraFailure(t *testing.T) {
+	f := newFlow(t, nil)
+	defer f.close()
+	f.hydra.AddLogin(testLoginRequest("l1"))
+	f.hydra.Fail(http.MethodPut, "/oauth2/auth/requests/login/accept", http.StatusInternalServerError)
+
+	if res := f.login("l1", testEmail, testPassword); res.StatusCode != http.StatusBadGateway {
+		t.Errorf("got status %d, want 502", res.StatusCode)
+	}
+}
+
+func testConsentRequest(ch string) hydratest.ConsentRequest {
+	return hydratest.ConsentRequest{
+		Challenge:                    ch,
+		Subject:                      testSubject,
+		Client:                       login.Client{ClientID: "app"},
+		RequestedScope:               []string{"openid", "profile"},
+		RequestedAccessTokenAudience: []string{"api"},
+		Context:                      map[string]interface{}{"acr": "pwd", "amr": []string{"pwd"}},
+	}
+}
+
+const testConsentAccepted = `{
+	"grant_scope": ["openid", "profile"],
+	"grant_access_token_audience": ["api"],
+	"session": {
+		"access_token": {"role": "admin", "acr": "pwd", "amr": ["pwd"]},
+		"id_token": {"name": "Rick", "email": "rick@councilofricks.com", "role": "admin", "amr": ["pwd"]}
+	}
+}`
+
+func TestLoginAndConsent(t *testing.T) {
+	f := newFlow(t, nil)
+	defer f.close()
+	f.hydra.AddLogin(testLoginRequest("l1"))
+	f.hydra.AddConsent(testConsentRequest("c1"))
+
+	f.login("l1", testEmail, testPassword).wantRedirect(t, "accept")
+	f.get("/auth/consent?consent_challenge=c1").wantRedirect(t, "accept")
+
+	wantJSON(t, "accept body", f.accepted("consent", "c1"), testConsentAccepted)
+}
+
+func TestConsentSkip(t *testing.T) {
+	f := newFlow(t, nil)
+	defer f.close()
+
+	req := testConsentRequest("c1")
+	req.Skip = true
+	f.hydra.AddConsent(req)
+
+	f.get("/auth/consent?consent_challenge=c1").wantRedirect(t, "accept")
+	wantJSON(t, "accept body", f.accepted("consent", "c1"), testConsentAccepted)
+}
+
+// The claims come from the user with the subject of the consent request,
+// not from the session of the browser, which a skipped login or a login in
+// another browser does not have
+func TestConsentWithoutLoginSession(t *testing.T) {
+	f := newFlow(t, nil)
+	defer f.close()
+	f.hydra.AddConsent(testConsentRequest("c1"))
+
+	f.get("/auth/consent?consent_challenge=c1").wantRedirect(t, "accept")
+	wantJSON(t, "accept body", f.accepted("consent", "c1"), testConsentAccepted)
+}
+
+func TestConsentRejectsUnknownAndDisabledUsers(t *testing.T) {
+	for ch, subject := range map[string]string{
+		"unknown":  "00000000-0000-0000-0000-000000000000",
+		"disabled": "c2b3a1d0-5e6f-4a7b-8c9d-0e1f2a3b4c5d",
+	} {
+		f := newFlow(t, nil)
+
+		req := testConsentRequest(ch)
+		req.Subject = subject
+		f.hydra.AddConsent(req)
+
+		f.get("/auth/consent?consent_challenge="+ch).wantRedirect(t, "reject")
+		wantJSON(t, ch+" reject body", f.rejected("consent", ch), `{
+			"error": "access_denied",
+			"error_description": "The user no longer has access",
+			"status_code": 403
+		}`)
+
+		f.close()
+	}
+}
+
+func TestConsentWithoutChallenge(t *testing.T) {
+	f := newFlow(t, nil)
+	defer f.close()
+
+	if res := f.get("/auth/consent"); res.StatusCode != http.StatusBadRequest {
+		t.Errorf("got status %d, want 400", res.StatusCode)
+	}
+}
+
+func TestLogout(t *testing.T) {
+	f := newFlow(t, nil)
+	defer f.close()
+	f.hydra.AddLogin(testLoginRequest("l1"))
+	f.login("l1", testEmail, testPassword).wantRedirect(t, "accept")
+
+	f.hydra.AddLogout("o1", hydratest.LogoutRequest{Subject: testSubject, SessionID: "s1"})
+	f.get("/auth/logout?logout_challenge=o1").wantRedirect(t, "accept")
+	f.accepted("logout", "o1")
+
+	// The applications keep their access
+	wantRevoked(t, f.hydra, map[string]bool{"login": true, "consent": false})
+
+	// The session is gone, so the next login asks for the password
+	f.hydra.AddLogin(testLoginRequest("l2"))
+	if res := f.get("/auth/login?login_challenge=l2"); res.StatusCode != http.StatusOK {
+		t.Errorf("login after logout got status %d, want the login form", res.StatusCode)
+	}
+}
+
+func TestLogoutConfirm(t *testing.T) {
+	f := newFlow(t, func(cfg *config.Config) { cfg.LogoutConfirm = true })
+	defer f.close()
+
+	f.hydra.AddLogout("o1", hydratest.LogoutRequest{Subject: testSubject})
+	confirm := f.get("/auth/logout?logout_challenge=o1")
+	if confirm.StatusCode != http.StatusOK {
+		t.Fatalf("got status %d, want the confirmation page", confirm.StatusCode)
+	}
+	if _, ok := f.hydra.Accepted("logout", "o1"); ok {
+		t.Fatal("the logout request was accepted before it was confirmed")
+	}
+
+	f.post("/auth/logout", url.Values{
+		"challenge":  {"o1"},
+		"confirm":    {"false"},
+		"csrf_token": {confirm.csrfToken(t)},
+	})
+	wantJSON(t, "reject body", f.rejected("logout", "o1"), `{"error": "access_denied"}`)
+
+	f.hydra.AddLogout("o2", hydratest.LogoutRequest{Subject: testSubject})
+	confirm = f.get("/auth/logout?logout_challenge=o2")
+	f.post("/auth/logout", url.Values{
+		"challenge":  {"o2"},
+		"confirm":    {"true"},
+		"csrf_token": {confirm.csrfToken(t)},
+	}).wantRedirect(t, "accept")
+	f.accepted("logout", "o2")
+}
+
+func TestLogoutEverywhere(t *testing.T) {
+	f := newFlow(t, func(cfg *config.Config) { cfg.LogoutConfirm = true })
+	defer f.close()
+
+	f.hydra.AddLogout("o1", hydratest.LogoutRequest{Subject: testSubject})
+	confirm := f.get("/auth/logout?logout_challenge=o1")
+	if !strings.Contains(confirm.body, `name="everywhere"`) {
+		t.Errorf("the confirmation page does not offer to sign out everywhere:\n%s", confirm.body)
+	}
+	f.post("/auth/logout", url.Values{
+		"challenge":  {"o1"},
+		"confirm":    {"true"},
+		"everywhere": {"true"},
+		"csrf_token": {confirm.csrfToken(t)},
+	}).wantRedirect(t, "accept")
+
+	f.accepted("logout", "o1")
+	wantRevoked(t, f.hydra, map[string]bool{"login": true, "consent": true})
+}
+
+// Only the login and consent flows can be framed by frame_ancestors
+func TestFrameAncestors(t *testing.T) {
+	f := newFlow(t, func(cfg *config.Config) { cfg.FrameAncestors = "https://app.example.com" })
+	defer f.close()
+
+	tests := []struct {
+		path      string
+		ancestors string
+		frame     string
+	}{
+		{"/auth/login?login_challenge=ch", "frame-ancestors https://app.example.com", ""},
+		{"/auth/consent?consent_challenge=ch", "frame-ancestors https://app.example.com", ""},
+		{"/auth/account", "frame-ancestors 'none'", "DENY"},
+		{"/auth/apps", "frame-ancestors 'none'", "DENY"},
+	}
+
+	for _, tt := range tests {
+		res := f.get(tt.path)
+		csp := res.Header.Get("Content-Security-Policy")
+		if !strings.Contains(csp, tt.ancestors+";") {
+			t.Errorf("%s: Content-Security-Policy = %q, want %q", tt.path, csp, tt.ancestors)
+		}
+		if got := res.Header.Get("X-Frame-Options"); got != tt.frame {
+			t.Errorf("%s: X-Frame-Options = %q, want %q", tt.path, got, tt.frame)
+		}
+	}
+}
+
+// The templates get the nonce the policy of the response allows
+func TestLayoutDataNonce(t *testing.T) {
+	s := newTestServer(t, "http://hydra.test", nil)
+	defer s.Close()
+
+	var data authboss.HTMLData
+	h := secure.Middleware(secure.Options{})(s.ab.LoadClientStateMiddleware(s.dataInjector(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ = r.Context().Value(authboss.CTXKeyData).(authboss.HTMLData)
+	}))))
+
+	seen := map[string]bool{}
+	for i := 0; i < 10; i++ {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/auth/login", nil))
+
+		nonce, _ := data["csp_nonce"].(string)
+		if nonce == "" || seen[nonce] {
+			t.Fatalf("csp_nonce = %q, want a new nonce on every request", nonce)
+		}
+		seen[nonce] = true
+
+		if csp := rec.Header().Get("Content-Security-Policy"); !strings.Contains(csp, "script-src 'self' 'nonce-"+nonce+"';") {
+			t.Errorf("the policy %q does not allow csp_nonce %q", csp, nonce)
+		}
+	}
+}
+
+// wantRevoked checks which kinds of Hydra sessions of the test user were
+// revoked
+func wantRevoked(t *testing.T, hydra *hydratest.Server, want map[string]bool) {
+	t.Helper()
+
+	got := map[string]bool{}
+	for _, call := range hydra.Calls() {
+		if call.Method == http.MethodDelete && call.Query.Get("subject") == testSubject {
+			got[strings.TrimPrefix(call.Path, "/oauth2/auth/sessions/")] = true
+		}
+	}
+
+	for kind, revoked := range want {
+		if got[kind] != revoked {
+			t.Errorf("%s sessions revoked: %v, want %v", kind, got[kind], revoked)
+		}
+	}
+}
+
+func mustJSON(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+
+	return string(b)
+}
@@ -0,0 +1,91 @@
+package session
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often stores drop expired sessions
+const sweepInterval = time.Minute
+
+// MemoryStore keeps sessions in memory. Sessions are lost on restart and not
+// shared between replicas.
+type MemoryStore struct {
+	mu        sync.RWMutex
+	sessions  map[string]Session
+	lastSweep time.Time
+}
+
+// NewMemoryStore creates an empty MemoryStore
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{sessions: map[string]Session{}}
+}
+
+// Load the session
+func (m *MemoryStore) Load(ctx context.Context, id string) (Session, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	s, ok := m.sessions[id]
+	if !ok || !s.Expires.After(time.Now()) {
+		return Session{}, ErrNotFound
+	}
+
+	return copySession(s), nil
+}
+
+// Save the session, dropping the expired ones every now and then
+func (m *MemoryStore) Save(ctx context.Context, s Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sessions[s.ID] = copySession(s)
+
+	if now := time.Now(); now.Sub(m.lastSweep) > sweepInterval {
+		for id, s := range m.sessions {
+			if !s.Expires.After(now) {
+				delete(m.sessions, id)
+			}
+		}
+		m.lastSweep = now
+	}
+
+	return nil
+}
+
+// Delete the session
+func (m *MemoryStore) Delete(ctx context.Context, id string) error {
+	m.mu.Lock()
+	delete(m.sessions, id)
+	m.mu.Unlock()
+
+	return nil
+}
+
+// List the sessions of the user
+func (m *MemoryStore) List(ctx context.Context, pid string) ([]Session, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	now := time.Now()
+	var out []Session
+	for _, s := range m.sessions {
+		if s.PID == pid && s.Expires.After(now) {
+			out = append(out, copySession(s))
+		}
+	}
+
+	return out, nil
+}
+
+// copySession keeps callers from changing stored values
+func copySession(s Session) Session {
+	values := make(map[string]string, len(s.Values))
+	for k, v := range s.Values {
+		values[k] = v
+	}
+	s.Values = values
+
+	return s
+}
@@ -0,0 +1,233 @@
+// Package session keeps sessions on the server, with only a random session
+// ID in the cookie. Unlike sessions held in the cookie itself, they are not
+// limited in size, can be listed and revoked, and are shared by every replica
+// using the same store.
+package session
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"github.com/volatiletech/authboss"
+)
+
+// ErrNotFound is returned by stores for sessions that do not exist or have
+// expired
+var ErrNotFound = errors.New("session not found")
+
+// Session is the state of a browser session
+type Session struct {
+	ID string
+	// PID is the user logged in with the session, if any
+	PID     string
+	Values  map[string]string
+	Expires time.Time
+}
+
+// Store persists sessions. Implementations must be safe for concurrent use,
+// and must not return expired sessions.
+type Store interface {
+	// Load returns the session with the given ID, or ErrNotFound
+	Load(ctx context.Context, id string) (Session, error)
+	// Save creates or replaces a session
+	Save(ctx context.Context, s Session) error
+	// Delete removes a session, and does nothing if it does not exist
+	Delete(ctx context.Context, id string) error
+	// List returns the sessions of a user
+	List(ctx context.Context, pid string) ([]Session, error)
+}
+
+// Revoke deletes every session of a user, logging them out everywhere
+func Revoke(ctx context.Context, store Store, pid string) error {
+	sessions, err := store.List(ctx, pid)
+	if err != nil {
+		return err
+	}
+
+	for _, s := range sessions {
+		if err := store.Delete(ctx, s.ID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Storer keeps authboss session state in a Store. It implements
+// authboss.ClientStateReadWriter.
+type Storer struct {
+	Name  string
+	Store Store
+	// TTL is how long a session lasts since it was last written to
+	TTL time.Duration
+	// Secure marks the cookie as only to be sent over https
+	Secure bool
+
+	codecs []securecookie.Codec
+}
+
+// NewStorer creates a Storer whose cookie, named name, is authenticated
+// with keyPairs, as for securecookie.CodecsFromPairs
+func NewStorer(name string, store Store, ttl time.Duration, keyPairs ...[]byte) *Storer {
+	codecs := securecookie.CodecsFromPairs(keyPairs...)
+	for _, c := range codecs {
+		c.(*securecookie.SecureCookie).MaxAge(int(ttl / time.Second))
+	}
+
+	return &Storer{
+		Name:   name,
+		Store:  store,
+		TTL:    ttl,
+		codecs: codecs,
+	}
+}
+
+// State is the session state of a request
+type State struct {
+	session Session
+	isNew   bool
+}
+
+// Get a value from the session
+func (s *State) Get(key string) (string, bool) {
+	v, ok := s.session.Values[key]
+	return v, ok
+}
+
+// Values returns the values of the session
+func (s *State) Values() map[string]string {
+	return s.session.Values
+}
+
+// ReadState loads the session named by the cookie. Requests without a
+// session, or whose session has expired or been revoked, get a new one.
+func (s *Storer) ReadState(r *http.Request) (authboss.ClientState, error) {
+	state := &State{session: Session{Values: map[string]string{}}, isNew: true}
+
+	cookie, err := r.Cookie(s.Name)
+	if err != nil {
+		return state, nil
+	}
+
+	var id string
+	if err := securecookie.DecodeMulti(s.Name, cookie.Value, &id, s.codecs...); err != nil {
+		return state, nil
+	}
+
+	session, err := s.Store.Load(r.Context(), id)
+	if err == ErrNotFound {
+		return state, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if session.Values == nil {
+		session.Values = map[string]string{}
+	}
+
+	return &State{session: session}, nil
+}
+
+// WriteState applies the changes made during the request and saves the
+// session. The session gets a new ID whenever a user logs in or out, so an
+// ID planted before the login is worthless after it.
+func (s *Storer) WriteState(w http.ResponseWriter, cs authboss.ClientState, ev []authboss.ClientStateEvent) error {
+	ctx := context.Background()
+
+	state, ok := cs.(*State)
+	if !ok || state == nil {
+		state = &State{session: Session{Values: map[string]string{}}, isNew: true}
+	}
+
+	session := state.session
+	values := map[string]string{}
+	for k, v := range session.Values {
+		values[k] = v
+	}
+
+	for _, e := range ev {
+		switch e.Kind {
+		case authboss.ClientStateEventPut:
+			values[e.Key] = e.Value
+		case authboss.ClientStateEventDel:
+			delete(values, e.Key)
+		case authboss.ClientStateEventDelAll:
+			keep := map[string]bool{}
+			for _, k := range strings.Split(e.Key, ",") {
+				keep[k] = true
+			}
+			for k := range values {
+				if !keep[k] {
+					delete(values, k)
+				}
+			}
+		}
+	}
+
+	pid := values[authboss.SessionKey]
+	if !state.isNew && (pid != session.PID || len(values) == 0) {
+		if err := s.Store.Delete(ctx, session.ID); err != nil {
+			return err
+		}
+		session.ID = ""
+	}
+
+	if len(values) == 0 {
+		http.SetCookie(w, s.cookie("", -1))
+		return nil
+	}
+
+	if session.ID == "" {
+		id, err := newID()
+		if err != nil {
+			return err
+		}
+		session.ID = id
+	}
+	session.PID = pid
+	session.Values = values
+	session.Expires = time.Now().Add(s.TTL)
+
+	if err := s.Store.Save(ctx, session); err != nil {
+		return err
+	}
+
+	encoded, err := securecookie.EncodeMulti(s.Name, session.ID, s.codecs...)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, s.cookie(encoded, int(s.TTL/time.Second)))
+
+	return nil
+}
+
+func (s *Storer) cookie(value string, maxAge int) *http.Cookie {
+	c := &http.Cookie{
+		Name:     s.Name,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   s.Secure,
+	}
+	if maxAge > 0 {
+		c.Expires = time.Now().Add(time.Duration(maxAge) * time.Second)
+	}
+
+	return c
+}
+
+// newID returns a random, unguessable session ID
+func newID() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
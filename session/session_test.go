@@ -0,0 +1,200 @@
+package session
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/volatiletech/authboss"
+)
+
+var testKey = []byte("0123456789abcdef0123456789abcdef")
+
+// write saves the changes to state and returns the cookie set
+func write(t *testing.T, s *Storer, state authboss.ClientState, ev ...authboss.ClientStateEvent) *http.Cookie {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	if err := s.WriteState(rec, state, ev); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range rec.Result().Cookies() {
+		if c.Name == s.Name {
+			return c
+		}
+	}
+	t.Fatal("no session cookie was set")
+	return nil
+}
+
+// read loads the state of a request sending cookie
+func read(t *testing.T, s *Storer, cookie *http.Cookie) *State {
+	t.Helper()
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	if cookie != nil {
+		r.AddCookie(cookie)
+	}
+
+	state, err := s.ReadState(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return state.(*State)
+}
+
+func put(key, value string) authboss.ClientStateEvent {
+	return authboss.ClientStateEvent{Kind: authboss.ClientStateEventPut, Key: key, Value: value}
+}
+
+func delAll(whitelist string) authboss.ClientStateEvent {
+	return authboss.ClientStateEvent{Kind: authboss.ClientStateEventDelAll, Key: whitelist}
+}
+
+func TestStorer(t *testing.T) {
+	rick, morty := testPID+"rick", testPID+"morty"
+
+	tests := []struct {
+		name    string
+		start   []authboss.ClientStateEvent
+		change  []authboss.ClientStateEvent
+		want    map[string]string
+		rotated bool
+	}{
+		{
+			name:   "new value",
+			start:  []authboss.ClientStateEvent{put(authboss.SessionKey, rick)},
+			change: []authboss.ClientStateEvent{put("flash", "hi")},
+			want:   map[string]string{authboss.SessionKey: rick, "flash": "hi"},
+		},
+		{
+			name:    "login",
+			start:   []authboss.ClientStateEvent{put("csrf", "token")},
+			change:  []authboss.ClientStateEvent{put(authboss.SessionKey, rick)},
+			want:    map[string]string{authboss.SessionKey: rick, "csrf": "token"},
+			rotated: true,
+		},
+		{
+			name:    "other user",
+			start:   []authboss.ClientStateEvent{put(authboss.SessionKey, rick)},
+			change:  []authboss.ClientStateEvent{put(authboss.SessionKey, morty)},
+			want:    map[string]string{authboss.SessionKey: morty},
+			rotated: true,
+		},
+		{
+			name:    "logout keeping the whitelist",
+			start:   []authboss.ClientStateEvent{put(authboss.SessionKey, rick), put("remember", "yes"), put("lang", "es")},
+			change:  []authboss.ClientStateEvent{delAll("lang,theme")},
+			want:    map[string]string{"lang": "es"},
+			rotated: true,
+		},
+		{
+			name:    "logout",
+			start:   []authboss.ClientStateEvent{put(authboss.SessionKey, rick), put("remember", "yes")},
+			change:  []authboss.ClientStateEvent{delAll("")},
+			rotated: true,
+		},
+	}
+
+	for _, st := range stores {
+		t.Run(st.name, func(t *testing.T) {
+			store, close := st.open(t)
+			defer close()
+
+			for _, tt := range tests {
+				t.Run(tt.name, func(t *testing.T) {
+					s := NewStorer("session", store, time.Hour, testKey)
+
+					before := read(t, s, write(t, s, nil, tt.start...))
+					if before.isNew {
+						t.Fatal("the session was not saved")
+					}
+
+					cookie := write(t, s, before, tt.change...)
+					after := read(t, s, cookie)
+
+					if len(tt.want) == 0 {
+						if cookie.MaxAge >= 0 || !after.isNew {
+							t.Errorf("the session was kept, cookie %v", cookie)
+						}
+					} else if !equalValues(after.Values(), tt.want) {
+						t.Errorf("values = %v, want %v", after.Values(), tt.want)
+					}
+					if len(tt.want) > 0 && after.session.PID != tt.want[authboss.SessionKey] {
+						t.Errorf("pid = %q, want %q", after.session.PID, tt.want[authboss.SessionKey])
+					}
+
+					rotated := after.session.ID != before.session.ID
+					if rotated != tt.rotated {
+						t.Errorf("session id rotated: %v, want %v", rotated, tt.rotated)
+					}
+					if _, err := store.Load(context.Background(), before.session.ID); tt.rotated && err != ErrNotFound {
+						t.Errorf("loading the session before the rotation returned %v, want ErrNotFound", err)
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestStorerStartsOverWithoutAValidSession(t *testing.T) {
+	rick := testPID + "rick"
+
+	for _, st := range stores {
+		t.Run(st.name, func(t *testing.T) {
+			store, close := st.open(t)
+			defer close()
+			ctx := context.Background()
+
+			s := NewStorer("session", store, time.Hour, testKey)
+			other := NewStorer("session", store, time.Hour, []byte("fedcba9876543210fedcba9876543210"))
+
+			expired := write(t, s, nil, put(authboss.SessionKey, rick))
+			state := read(t, s, expired)
+			state.session.Expires = time.Now().Add(-time.Second)
+			if err := store.Save(ctx, state.session); err != nil {
+				t.Fatal(err)
+			}
+
+			revoked := write(t, s, nil, put(authboss.SessionKey, rick))
+			if err := Revoke(ctx, store, rick); err != nil {
+				t.Fatal(err)
+			}
+
+			tests := []struct {
+				name   string
+				cookie *http.Cookie
+			}{
+				{"no cookie", nil},
+				{"expired", expired},
+				{"revoked", revoked},
+				{"signed with another key", write(t, other, nil, put(authboss.SessionKey, rick))},
+				{"tampered", &http.Cookie{Name: "session", Value: "forged"}},
+			}
+
+			for _, tt := range tests {
+				state := read(t, s, tt.cookie)
+				if !state.isNew || len(state.Values()) > 0 {
+					t.Errorf("%s: got the session %+v, want a new one", tt.name, state.session)
+				}
+			}
+		})
+	}
+}
+
+func equalValues(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if w, ok := b[k]; !ok || w != v {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,134 @@
+package session
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// SQLStore keeps sessions in a SQL database, so they survive restarts and
+// are shared between replicas. The queries are written for PostgreSQL.
+type SQLStore struct {
+	db *sql.DB
+
+	mu        sync.Mutex
+	lastSweep time.Time
+}
+
+const createSessions = `CREATE TABLE IF NOT EXISTS sessions (
+	id      TEXT PRIMARY KEY,
+	pid     TEXT NOT NULL,
+	data    TEXT NOT NULL,
+	expires TIMESTAMP WITH TIME ZONE NOT NULL
+)`
+
+const createSessionsPID = `CREATE INDEX IF NOT EXISTS sessions_pid ON sessions (pid)`
+
+// NewSQLStore creates the sessions table if it does not exist
+func NewSQLStore(db *sql.DB) (*SQLStore, error) {
+	for _, q := range []string{createSessions, createSessionsPID} {
+		if _, err := db.Exec(q); err != nil {
+			return nil, err
+		}
+	}
+
+	return &SQLStore{db: db}, nil
+}
+
+// Load the session
+func (s *SQLStore) Load(ctx context.Context, id string) (Session, error) {
+	session := Session{ID: id}
+	var data string
+
+	err := s.db.QueryRowContext(ctx,
+		`SELECT pid, data, expires FROM sessions WHERE id = $1 AND expires > $2`,
+		id, time.Now(),
+	).Scan(&session.PID, &data, &session.Expires)
+	if err == sql.ErrNoRows {
+		return Session{}, ErrNotFound
+	} else if err != nil {
+		return Session{}, err
+	}
+
+	if err := json.Unmarshal([]byte(data), &session.Values); err != nil {
+		return Session{}, err
+	}
+
+	return session, nil
+}
+
+// Save the session, dropping the expired ones every now and then
+func (s *SQLStore) Save(ctx context.Context, session Session) error {
+	data, err := json.Marshal(session.Values)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.ExecContext(ctx,
+		`INSERT INTO sessions (id, pid, data, expires) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (id) DO UPDATE SET pid = excluded.pid, data = excluded.data, expires = excluded.expires`,
+		session.ID, session.PID, string(data), session.Expires,
+	)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	now := time.Now()
+	sweep := now.Sub(s.lastSweep) > sweepInterval
+	if sweep {
+		s.lastSweep = now
+	}
+	s.mu.Unlock()
+
+	if sweep {
+		_, err = s.db.ExecContext(ctx, `DELETE FROM sessions WHERE expires <= $1`, now)
+	}
+
+	return err
+}
+
+// Delete the session
+func (s *SQLStore) Delete(ctx context.Context, id string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM sessions WHERE id = $1`, id)
+	return err
+}
+
+// List the sessions of the user
+func (s *SQLStore) List(ctx context.Context, pid string) ([]Session, error) {
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, data, expires FROM sessions WHERE pid = $1 AND expires > $2`,
+		pid, time.Now(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []Session
+	for rows.Next() {
+		session := Session{PID: pid}
+		var data string
+		if err := rows.Scan(&session.ID, &data, &session.Expires); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(data), &session.Values); err != nil {
+			return nil, err
+		}
+		out = append(out, session)
+	}
+
+	return out, rows.Err()
+}
+
+// Ping checks that the database is reachable
+func (s *SQLStore) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+// Close the database
+func (s *SQLStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,147 @@
+package session
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"sort"
+	"testing"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+// testDSN names the environment variable holding the PostgreSQL database
+// SQLStore is tested against. Its tests are skipped when it is not set.
+const testDSN = "SESSION_STORE_TEST_DSN"
+
+// testPID prefixes the users of the sessions the tests save, so they can be
+// removed from a shared database afterwards
+const testPID = "session-test-"
+
+var stores = []struct {
+	name string
+	open func(t *testing.T) (Store, func())
+}{
+	{"memory", func(*testing.T) (Store, func()) { return NewMemoryStore(), func() {} }},
+	{"sql", openSQLStore},
+}
+
+func openSQLStore(t *testing.T) (Store, func()) {
+	t.Helper()
+
+	dsn := os.Getenv(testDSN)
+	if dsn == "" {
+		t.Skip(testDSN + " is not set")
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store, err := NewSQLStore(db)
+	if err != nil {
+		db.Close()
+		t.Fatal(err)
+	}
+
+	return store, func() {
+		db.Exec(`DELETE FROM sessions WHERE pid LIKE $1`, testPID+"%")
+		store.Close()
+	}
+}
+
+func ids(sessions []Session) []string {
+	var out []string
+	for _, s := range sessions {
+		out = append(out, s.ID)
+	}
+	sort.Strings(out)
+
+	return out
+}
+
+func TestStores(t *testing.T) {
+	rick, morty := testPID+"rick", testPID+"morty"
+	now := time.Now()
+
+	for _, tt := range stores {
+		t.Run(tt.name, func(t *testing.T) {
+			store, close := tt.open(t)
+			defer close()
+			ctx := context.Background()
+
+			for _, s := range []Session{
+				{ID: tt.name + "-rick-1", PID: rick, Values: map[string]string{"uid": rick}, Expires: now.Add(time.Hour)},
+				{ID: tt.name + "-rick-2", PID: rick, Values: map[string]string{"uid": rick}, Expires: now.Add(time.Hour)},
+				{ID: tt.name + "-rick-expired", PID: rick, Values: map[string]string{"uid": rick}, Expires: now.Add(-time.Second)},
+				{ID: tt.name + "-morty", PID: morty, Values: map[string]string{"uid": morty}, Expires: now.Add(time.Hour)},
+			} {
+				if err := store.Save(ctx, s); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			got, err := store.Load(ctx, tt.name+"-rick-1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.PID != rick || got.Values["uid"] != rick {
+				t.Errorf("loaded %+v", got)
+			}
+
+			// Changing what was loaded does not change the stored session
+			got.Values["uid"] = morty
+			if again, _ := store.Load(ctx, tt.name+"-rick-1"); again.Values["uid"] != rick {
+				t.Errorf("the stored values changed with the loaded ones: %v", again.Values)
+			}
+
+			for _, id := range []string{tt.name + "-unknown", tt.name + "-rick-expired"} {
+				if _, err := store.Load(ctx, id); err != ErrNotFound {
+					t.Errorf("loading %s returned %v, want ErrNotFound", id, err)
+				}
+			}
+
+			list, err := store.List(ctx, rick)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, want := ids(list), []string{tt.name + "-rick-1", tt.name + "-rick-2"}; !equal(got, want) {
+				t.Errorf("listed %v, want %v", got, want)
+			}
+
+			if err := store.Delete(ctx, tt.name+"-rick-1"); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := store.Load(ctx, tt.name+"-rick-1"); err != ErrNotFound {
+				t.Errorf("loading a deleted session returned %v, want ErrNotFound", err)
+			}
+			if err := store.Delete(ctx, tt.name+"-unknown"); err != nil {
+				t.Errorf("deleting an unknown session returned %v", err)
+			}
+
+			if err := Revoke(ctx, store, rick); err != nil {
+				t.Fatal(err)
+			}
+			if list, _ := store.List(ctx, rick); len(list) > 0 {
+				t.Errorf("sessions %v are left after revoking them", ids(list))
+			}
+			if _, err := store.Load(ctx, tt.name+"-morty"); err != nil {
+				t.Errorf("the session of another user was revoked: %v", err)
+			}
+		})
+	}
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
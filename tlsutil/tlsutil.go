@@ -0,0 +1,173 @@
+// Package tlsutil loads certificates for the server and for the connection
+// to Hydra, picking up renewed certificate files without a restart.
+package tlsutil
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/nbycomp/login-consent/logging"
+)
+
+// reloadInterval is how often the certificate files are checked for changes
+const reloadInterval = 10 * time.Second
+
+// Reloader holds a certificate and key pair, reloading it when either file
+// changes, e.g. when cert-manager renews a Kubernetes secret
+type Reloader struct {
+	certFile string
+	keyFile  string
+	log      *logging.Logger
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time
+	checked time.Time
+}
+
+// NewReloader loads the pair of files. Reloads are logged to log.
+func NewReloader(certFile, keyFile string, log *logging.Logger) (*Reloader, error) {
+	r := &Reloader{certFile: certFile, keyFile: keyFile, log: log}
+	if _, err := r.load(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Certificate returns the current certificate. If reloading a changed pair
+// fails, the previous certificate is kept.
+func (r *Reloader) Certificate() (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if time.Since(r.checked) < reloadInterval {
+		return r.cert, nil
+	}
+	r.checked = time.Now()
+
+	modTime, err := r.modified()
+	if err != nil || !modTime.After(r.modTime) {
+		return r.cert, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		r.log.Error("failed to reload certificate, keeping the previous one", "cert", r.certFile, "error", err)
+		return r.cert, nil
+	}
+	r.cert, r.modTime = &cert, modTime
+	r.log.Info("reloaded certificate", "cert", r.certFile)
+
+	return r.cert, nil
+}
+
+// GetCertificate is used as tls.Config.GetCertificate
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return r.Certificate()
+}
+
+// GetClientCertificate is used as tls.Config.GetClientCertificate
+func (r *Reloader) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return r.Certificate()
+}
+
+func (r *Reloader) load() (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	modTime, err := r.modified()
+	if err != nil {
+		return nil, err
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load key pair %s, %s: %v", r.certFile, r.keyFile, err)
+	}
+
+	r.cert, r.modTime, r.checked = &cert, modTime, time.Now()
+
+	return r.cert, nil
+}
+
+// modified returns the latest modification time of the two files
+func (r *Reloader) modified() (time.Time, error) {
+	var latest time.Time
+	for _, name := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(name)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+
+	return latest, nil
+}
+
+// ServerConfig serves the certificate and key files, logging reloads to log
+func ServerConfig(certFile, keyFile string, log *logging.Logger) (*tls.Config, error) {
+	if certFile == "" || keyFile == "" {
+		return nil, errors.New("both a certificate and a key file are required")
+	}
+
+	r, err := NewReloader(certFile, keyFile, log)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: r.GetCertificate,
+	}, nil
+}
+
+// ClientConfig trusts the certificates in caFile in addition to the system
+// ones and presents the client certificate, for mutual TLS. Any of the files
+// can be left empty. It returns nil when there is nothing to configure.
+// Reloads of the client certificate are logged to log.
+func ClientConfig(caFile, certFile, keyFile string, log *logging.Logger) (*tls.Config, error) {
+	if caFile == "" && certFile == "" && keyFile == "" {
+		return nil, nil
+	}
+
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if caFile != "" {
+		pem, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", caFile)
+		}
+		config.RootCAs = pool
+	}
+
+	if certFile != "" || keyFile != "" {
+		if certFile == "" || keyFile == "" {
+			return nil, errors.New("both a client certificate and a key file are required")
+		}
+
+		r, err := NewReloader(certFile, keyFile, log)
+		if err != nil {
+			return nil, err
+		}
+		config.GetClientCertificate = r.GetClientCertificate
+	}
+
+	return config, nil
+}